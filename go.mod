@@ -17,6 +17,7 @@ require (
 	github.com/prometheus/client_golang v1.11.0
 	github.com/tebeka/strftime v0.1.5 // indirect
 	github.com/toolkits/pkg v1.1.3
+	golang.org/x/net v0.0.0-20201202161906-c7110b5ffcbb
 	gorm.io/driver/mysql v1.0.2
 	gorm.io/driver/sqlite v1.1.3
 	gorm.io/gorm v1.20.2
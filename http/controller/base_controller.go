@@ -11,9 +11,9 @@ import (
 // BaseController for gin framework
 type BaseController struct{}
 
-// JSON return json response by default response
+// JSON return json response by default response, request id is filled in
 func (ctl BaseController) JSON(c *gin.Context, resp *response.DefaultResponse) {
-	c.JSON(resp.Status, resp)
+	response.JSON(c, resp.Status, resp)
 }
 
 // DefaultURLParamStr get url param.
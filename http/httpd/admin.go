@@ -0,0 +1,197 @@
+package httpd
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	rpprof "runtime/pprof"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/lostyear/go-toolkits/http/middlewares/prommetric"
+	"github.com/lostyear/go-toolkits/http/middlewares/recovery"
+	"github.com/lostyear/go-toolkits/http/response"
+	logger "github.com/lostyear/go-toolkits/logger"
+)
+
+const serveRetryInterval = time.Second
+
+// adminServer serve metrics, pprof, runtime debug, route table, health and log level
+// on a separate listener, it is started and stopped with the server.
+type adminServer struct {
+	srv *http.Server
+	ln  net.Listener
+}
+
+func (s *Server) newAdminEngine(cfg Config) (*gin.Engine, error) {
+	guard, err := adminGuard(cfg.AdminToken, cfg.AdminAllowIPs)
+	if err != nil {
+		return nil, err
+	}
+
+	eng := gin.New()
+	eng.Use(recovery.Recovery(), guard)
+
+	eng.GET("/metrics", prommetric.MetricHandler())
+	eng.GET(livenessPath, s.health.LivenessHandler())
+	eng.GET(readinessPath, s.health.ReadinessHandler())
+	eng.GET("/debug/routes", RouteTableHandler(s.RouteTable))
+	eng.GET("/debug/pprof/*name", pprofHandler)
+	eng.POST("/debug/pprof/*name", pprofHandler)
+	eng.GET("/debug/vars", varsHandler)
+	eng.GET("/debug/goroutines", goroutinesHandler)
+	eng.GET("/debug/buildinfo", buildInfoHandler)
+	eng.GET("/debug/loglevel", logLevelHandler)
+	eng.PUT("/debug/loglevel", setLogLevelHandler)
+
+	return eng, nil
+}
+
+func (s *Server) serveAdmin(cfg Config, eng *gin.Engine) error {
+	ln, err := listen(cfg.AdminListen, cfg.UnixSocketMode)
+	if err != nil {
+		return err
+	}
+	admin := &adminServer{
+		srv: &http.Server{Handler: eng},
+		ln:  ln,
+	}
+	go admin.srv.Serve(ln)
+
+	s.mu.Lock()
+	s.admin = admin
+	s.mu.Unlock()
+
+	return nil
+}
+
+// serveBackground keep trying to serve until it succeeds or server stopped.
+// in graceful restart mode, the old process holds the address until it exits.
+func (s *Server) serveBackground(name string, serve func() error) {
+	go func() {
+		for {
+			err := serve()
+			if err == nil {
+				return
+			}
+			log.Printf("start %s server got error: %s, retry later\n", name, err.Error())
+
+			select {
+			case <-s.done:
+				return
+			case <-time.After(serveRetryInterval):
+			}
+		}
+	}()
+}
+
+func (a *adminServer) stop(ctx context.Context) error {
+	return a.srv.Shutdown(ctx)
+}
+
+// adminGuard check bearer token and client ip if they are configured
+func adminGuard(token string, allowIPs []string) (gin.HandlerFunc, error) {
+	nets := make([]*net.IPNet, 0, len(allowIPs))
+	for _, ip := range allowIPs {
+		if !strings.Contains(ip, "/") {
+			if strings.Contains(ip, ":") {
+				ip += "/128"
+			} else {
+				ip += "/32"
+			}
+		}
+		_, n, err := net.ParseCIDR(ip)
+		if err != nil {
+			return nil, fmt.Errorf("admin allow ip is invalid: %s", ip)
+		}
+		nets = append(nets, n)
+	}
+
+	return func(c *gin.Context) {
+		if len(nets) > 0 && !ipAllowed(c.Request.RemoteAddr, nets) {
+			response.AbortWithJSON(c, http.StatusForbidden, response.NewForbiddenResponse("ip not allowed"))
+			return
+		}
+		if len(token) > 0 {
+			auth := c.GetHeader("Authorization")
+			if !strings.HasPrefix(auth, "Bearer ") ||
+				subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, "Bearer ")), []byte(token)) != 1 {
+				response.AbortWithJSON(c, http.StatusUnauthorized, &response.DefaultResponse{
+					Status:  http.StatusUnauthorized,
+					Message: "invalid bearer token",
+				})
+				return
+			}
+		}
+		c.Next()
+	}, nil
+}
+
+// ipAllowed use the remote address of connection, headers like X-Forwarded-For are not trusted
+func ipAllowed(remoteAddr string, nets []*net.IPNet) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func goroutinesHandler(c *gin.Context) {
+	c.Header("Content-Type", "text/plain; charset=utf-8")
+	c.Status(http.StatusOK)
+	rpprof.Lookup("goroutine").WriteTo(c.Writer, 2)
+}
+
+func buildInfoHandler(c *gin.Context) {
+	data := gin.H{
+		"go_version": runtime.Version(),
+		"goroutines": runtime.NumGoroutine(),
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		data["path"] = info.Path
+		data["main"] = info.Main
+		data["deps"] = info.Deps
+	}
+	response.JSON(c, http.StatusOK, response.NewOKResonseData(data))
+}
+
+func logLevelHandler(c *gin.Context) {
+	response.JSON(c, http.StatusOK, response.NewOKResonseData(gin.H{"level": logger.Level()}))
+}
+
+// setLogLevelHandler change log level by query level or json body {"level": "DEBUG"}
+func setLogLevelHandler(c *gin.Context) {
+	level := c.Query("level")
+	if len(level) <= 0 {
+		var body struct {
+			Level string `json:"level"`
+		}
+		if err := c.ShouldBindJSON(&body); err != nil {
+			response.JSON(c, http.StatusBadRequest, response.NewBadRequestResponse(err.Error()))
+			return
+		}
+		level = body.Level
+	}
+
+	if err := logger.SetLevel(level); err != nil {
+		response.JSON(c, http.StatusBadRequest, response.NewBadRequestResponse(err.Error()))
+		return
+	}
+	response.JSON(c, http.StatusOK, response.NewOKResonseData(gin.H{"level": logger.Level()}))
+}
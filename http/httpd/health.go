@@ -0,0 +1,203 @@
+package httpd
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/lostyear/go-toolkits/http/response"
+)
+
+const (
+	livenessPath  = "/healthz"
+	readinessPath = "/readyz"
+
+	healthCheckTimeout = 3 * time.Second
+)
+
+// Check is a health check of a component, it returns error when the component is unhealthy
+type Check func(ctx context.Context) error
+
+// CheckResult is the result of a health check
+type CheckResult struct {
+	Status    string  `json:"status"` // ok or fail
+	Message   string  `json:"message,omitempty"`
+	LatencyMs float64 `json:"latency_ms"`
+}
+
+// Health holds named checks for liveness and readiness
+type Health struct {
+	mu        sync.RWMutex
+	liveness  map[string]Check
+	readiness map[string]Check
+
+	draining int32
+}
+
+// NewHealth create an empty health
+func NewHealth() *Health {
+	return &Health{
+		liveness:  map[string]Check{},
+		readiness: map[string]Check{},
+	}
+}
+
+// AddLivenessCheck add a named check for liveness, it is also used for readiness
+func (h *Health) AddLivenessCheck(name string, check Check) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.liveness[name] = check
+}
+
+// AddReadinessCheck add a named check for readiness
+func (h *Health) AddReadinessCheck(name string, check Check) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.readiness[name] = check
+}
+
+// SetDraining mark server draining, readiness will fail
+func (h *Health) SetDraining(draining bool) {
+	var v int32
+	if draining {
+		v = 1
+	}
+	atomic.StoreInt32(&h.draining, v)
+}
+
+// Draining return whether server is draining
+func (h *Health) Draining() bool {
+	return atomic.LoadInt32(&h.draining) == 1
+}
+
+// Live run liveness checks
+func (h *Health) Live(ctx context.Context) (bool, map[string]CheckResult) {
+	h.mu.RLock()
+	checks := make(map[string]Check, len(h.liveness))
+	for name, check := range h.liveness {
+		checks[name] = check
+	}
+	h.mu.RUnlock()
+
+	return runChecks(ctx, checks)
+}
+
+// Ready run liveness and readiness checks, it always fails when server is draining
+func (h *Health) Ready(ctx context.Context) (bool, map[string]CheckResult) {
+	h.mu.RLock()
+	checks := make(map[string]Check, len(h.liveness)+len(h.readiness))
+	for name, check := range h.liveness {
+		checks[name] = check
+	}
+	for name, check := range h.readiness {
+		checks[name] = check
+	}
+	h.mu.RUnlock()
+
+	ok, results := runChecks(ctx, checks)
+	return ok && !h.Draining(), results
+}
+
+// LivenessHandler serve liveness result in default response
+func (h *Health) LivenessHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ok, results := h.Live(c.Request.Context())
+		writeHealth(c, ok, "ok", results)
+	}
+}
+
+// ReadinessHandler serve readiness result in default response
+func (h *Health) ReadinessHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ok, results := h.Ready(c.Request.Context())
+		msg := "ok"
+		if h.Draining() {
+			msg = "draining"
+		}
+		writeHealth(c, ok, msg, results)
+	}
+}
+
+func writeHealth(c *gin.Context, ok bool, msg string, results map[string]CheckResult) {
+	status := http.StatusOK
+	if !ok {
+		status = http.StatusServiceUnavailable
+		if msg == "ok" {
+			msg = "unhealthy"
+		}
+	}
+	response.JSON(c, status, &response.DefaultResponse{
+		Status:  status,
+		Message: msg,
+		Data:    results,
+	})
+}
+
+func runChecks(ctx context.Context, checks map[string]Check) (bool, map[string]CheckResult) {
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		ok      = true
+		results = make(map[string]CheckResult, len(checks))
+	)
+	for name, check := range checks {
+		wg.Add(1)
+		go func(name string, check Check) {
+			defer wg.Done()
+
+			st := time.Now()
+			err := runCheck(ctx, check)
+			result := CheckResult{
+				Status:    "ok",
+				LatencyMs: float64(time.Since(st)) / float64(time.Millisecond),
+			}
+			if err != nil {
+				result.Status = "fail"
+				result.Message = err.Error()
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			results[name] = result
+			ok = ok && err == nil
+		}(name, check)
+	}
+	wg.Wait()
+
+	return ok, results
+}
+
+// runCheck run a check and treat panic as failure
+func runCheck(ctx context.Context, check Check) (err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("health check panic: %v", e)
+		}
+	}()
+	return check(ctx)
+}
+
+func registerHealth(eng *gin.Engine, h *Health) {
+	registered := map[string]bool{}
+	for _, r := range eng.Routes() {
+		if r.Method == http.MethodGet {
+			registered[r.Path] = true
+		}
+	}
+
+	// keep the handlers registered by user
+	if !registered[livenessPath] {
+		eng.GET(livenessPath, h.LivenessHandler())
+	}
+	if !registered[readinessPath] {
+		eng.GET(readinessPath, h.ReadinessHandler())
+	}
+}
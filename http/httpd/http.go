@@ -1,8 +1,9 @@
 package httpd
 
 import (
-	"context"
 	"fmt"
+	"io"
+	"log"
 	"net/http"
 	"time"
 
@@ -10,95 +11,152 @@ import (
 
 	"github.com/lostyear/go-toolkits/http/middlewares/n9emetric"
 	"github.com/lostyear/go-toolkits/http/middlewares/prommetric"
-	"github.com/lostyear/go-toolkits/http/middlewares/recovery"
-	"github.com/lostyear/go-toolkits/http/middlewares/requestlog"
-	"github.com/lostyear/go-toolkits/http/middlewares/timeout"
 	"github.com/lostyear/go-toolkits/http/response"
+	"github.com/lostyear/go-toolkits/metrics"
 )
 
 // RegisterHandler used for start func, it shoud register all handlers
 type RegisterHandler func(*gin.Engine)
 
-// NOTE: 信号处理需要在外部实现，reload config 需要有个读写锁
-
 // Config http server
 type Config struct {
-	Listen string
+	Listen         string // host:port, tcp://host:port, unix:///path.sock or fd://3
+	UnixSocketMode string // octal file mode of unix socket, default 0666
 
+	// Metric is the backend of http metrics: prom, n9e or memory, empty to disable.
+	// http metrics are owned by the server, storage and timer jobs report to
+	// the backend set by metrics.Init, which is called by the application once.
 	Metric           string
+	MetricListen     string // prometheus exporter address, empty to serve metrics on admin server only
+	MetricPath       string // prometheus exporter path, default /metrics
+	MetricNamespace  string // namespace of http metrics
+	MetricStatsdAddr string // n9e statsd agent address of http metrics, default 127.0.0.1:788
+
 	LogPath          string
 	LogRotationHours uint
 	LogMaxDays       uint
-
+	LogSink          string   // request log sink: file, stdout or syslog, default file if log path set
+	LogAsyncBuffer   int      // lines buffered to write request log in background, 0 to write synchronously
+	LogFormat        string   // request log format: text, json or logfmt, empty for the legacy log
+	LogFields        []string // fields of json and logfmt request log, empty for requestlog.DefaultFields
+	LogUserIDKey     string   // gin context key of user id in request log
+
+	// read timeout limits reading request header and body, and idle time of keep-alive connection,
+	// write timeout limits writing response. reloading them only changes the deadline of
+	// http/1 request body and response, header and idle timeouts take effect on restart.
 	HTTPTimeoutMilliseSecond  int
 	ReadTimeoutMilliseSecond  int
 	WriteTimeoutMilliseSecond int
+
+	HTTPRouteTimeouts         map[string]int // timeout ms by route, key is "METHOD /path" or "/path"
+	HTTPMaxTimeoutMilliSecond int            // max timeout client can ask by deadline header
+	HTTPIgnoreClientDeadline  bool           // ignore X-Request-Timeout and grpc-timeout headers
+	HTTPStreamRoutes          []string       // streaming routes served without timeout, "METHOD /path" or "/path"
+
+	ShutdownTimeoutMilliseSecond int  // max time to drain connections when stop by signal
+	GracefulRestart              bool // restart with listening socket inherited on SIGHUP or SIGUSR2
+
+	H2C                         bool   // serve http/2 cleartext on plain listener
+	HTTP2MaxConcurrentStreams   uint32 // max concurrent streams per http/2 connection, default 250
+	HTTP2IdleTimeoutMilliSecond int    // close idle http/2 connection after this time
+	MaxHeaderBytes              int    // max bytes of request header, default 1MB
+
+	TLSCertFile     string   // serve https when both cert and key file set
+	TLSKeyFile      string   // tls private key file
+	TLSClientCAFile string   // client ca bundle, enable mutual tls when set
+	TLSMinVersion   string   // min tls version: 1.0, 1.1, 1.2 or 1.3, default 1.2
+	TLSCipherSuites []string // cipher suite names, empty for go default
+
+	DumpRoutes     bool   // log route table when server start
+	RouteDebugPath string // serve route table on this path, empty to disable
+
+	AdminListen   string   // admin server address for metrics, pprof and debug, empty to disable
+	AdminToken    string   // bearer token required by admin server, empty for none
+	AdminAllowIPs []string // ip or cidr allowed to access admin server, empty for all
+
+	// Middlewares is the pipeline of built-in and registered middlewares in order,
+	// empty for default pipeline: requestid, metric, requestlog, timeout, recovery
+	Middlewares []MiddlewareConfig
+
+	// metrics of the engine being built, shared by metric, timeout and recovery middlewares
+	engineMetrics httpMetrics
 }
 
+// metric backends
+const (
+	MetricPrometheus = "prom"
+	MetricN9e        = "n9e"
+)
+
 var (
-	srv *http.Server
+	defaultServer *Server
 
 	emptyHandler = func(*gin.Context) {}
 )
 
 // StartServer run http server with config, handler should have all route regist action,
-// and all middlewares will be used.
-// also it has some default middlewares use
+// and all middlewares will be used after the config pipeline.
+// also it has some default middlewares use.
+// it runs a package default server, use New to run multiple servers in one process.
 func StartServer(cfg Config, handler RegisterHandler, middlewares gin.HandlersChain) error {
-	eng := gin.New()
+	defaultServer = New(cfg, handler, middlewares)
+	return defaultServer.ListenAndServe()
+}
 
-	eng.Use(GetMetricMiddleWare(cfg.Metric))
-	eng.Use(requestlog.RequestFileLogMiddleware(cfg.LogPath, cfg.LogRotationHours, cfg.LogMaxDays))
-	eng.Use(timeout.Middleware(time.Duration(cfg.HTTPTimeoutMilliseSecond) * time.Millisecond))
-	eng.Use(recovery.Recovery())
+// StopServer stop the server started by StartServer with timeout
+func StopServer(timeout time.Duration) error {
+	return defaultServer.Stop(timeout)
+}
+
+func newEngine(cfg Config, handler RegisterHandler, middlewares gin.HandlersChain) (*gin.Engine, io.Closer, error) {
+	pipeline, closer, err := buildPipeline(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
 
+	eng := gin.New()
+
+	eng.Use(pipeline...)
 	eng.Use(middlewares...)
 	eng.NoRoute(noRouteHandler)
 	eng.NoMethod(noMethodHandler)
 
 	handler(eng)
 
-	srv = &http.Server{
-		Addr:         cfg.Listen,
-		Handler:      eng,
-		ReadTimeout:  time.Duration(cfg.ReadTimeoutMilliseSecond) * time.Millisecond,
-		WriteTimeout: time.Duration(cfg.WriteTimeoutMilliseSecond) * time.Millisecond,
-	}
-
-	return srv.ListenAndServe()
-}
-
-// StopServer stop the server with timeout
-func StopServer(timeout time.Duration) error {
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
-	defer cancel()
-
-	return srv.Shutdown(ctx)
+	return eng, closer, nil
 }
 
 func noRouteHandler(c *gin.Context) {
-	c.JSON(http.StatusNotFound, response.DefaultResponse{
+	response.JSON(c, http.StatusNotFound, &response.DefaultResponse{
 		Status:  http.StatusNotFound,
 		Message: fmt.Sprintf("No route to your request: %s %s", c.Request.Method, c.Request.RequestURI),
 	})
 }
 
 func noMethodHandler(c *gin.Context) {
-	c.JSON(http.StatusNotFound, response.DefaultResponse{
+	response.JSON(c, http.StatusNotFound, &response.DefaultResponse{
 		Status:  http.StatusNotFound,
 		Message: fmt.Sprintf("Not support Method to your request: %s %s", c.Request.Method, c.Request.RequestURI),
 	})
 }
 
-// GetMetricMiddleWare choose use n9e or prometheus metric middleware
+// GetMetricMiddleWare choose use n9e or prometheus metric middleware,
+// other backends of metrics package are reported by a backend created for the middleware.
+// empty or unsupported metric disables it.
 func GetMetricMiddleWare(metric string) gin.HandlerFunc {
 	switch metric {
-	case "n9e":
+	case "":
+		return emptyHandler
+	case MetricN9e:
 		return n9emetric.MetricMiddleware()
-	case "prom":
-		prommetric.StartDefaultServer()
-		return prommetric.MetricHandler()
+	case MetricPrometheus:
+		return prommetric.MetricMiddleware()
 	default:
-		return emptyHandler
+		b, err := metrics.New(metrics.Config{Backend: metric})
+		if err != nil {
+			log.Printf("create metric middleware got error: %s\n", err.Error())
+			return emptyHandler
+		}
+		return newFacadeMetrics(b).Middleware()
 	}
 }
@@ -0,0 +1,33 @@
+package httpd
+
+import (
+	"net/http"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// configureHTTP2 apply http/2 options to server,
+// and serve http/2 cleartext if h2c is enabled.
+func (s *Server) configureHTTP2(cfg Config) error {
+	h2s := &http2.Server{
+		MaxConcurrentStreams: cfg.HTTP2MaxConcurrentStreams,
+		IdleTimeout:          time.Duration(cfg.HTTP2IdleTimeoutMilliSecond) * time.Millisecond,
+	}
+
+	s.srv.MaxHeaderBytes = cfg.MaxHeaderBytes
+	if s.srv.TLSConfig != nil {
+		if err := http2.ConfigureServer(s.srv, h2s); err != nil {
+			return err
+		}
+	}
+
+	var handler http.Handler = s
+	if cfg.H2C {
+		handler = h2c.NewHandler(s, h2s)
+	}
+	s.srv.Handler = handler
+
+	return nil
+}
@@ -0,0 +1,102 @@
+package httpd
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	schemeTCP  = "tcp://"
+	schemeUnix = "unix://"
+	schemeFD   = "fd://"
+
+	// first fd passed by systemd socket activation
+	listenFDsStart = 3
+
+	defaultUnixSocketMode = 0666
+)
+
+// listen create listener by spec, supported spec:
+//
+//	host:port or tcp://host:port for tcp address
+//	unix:///path/to/file.sock for unix domain socket
+//	fd://3 for inherited socket, like systemd socket activation
+func listen(spec, socketMode string) (net.Listener, error) {
+	switch {
+	case strings.HasPrefix(spec, schemeUnix):
+		return listenUnix(strings.TrimPrefix(spec, schemeUnix), socketMode)
+	case strings.HasPrefix(spec, schemeFD):
+		return listenFD(strings.TrimPrefix(spec, schemeFD))
+	default:
+		return net.Listen("tcp", strings.TrimPrefix(spec, schemeTCP))
+	}
+}
+
+// tcpAddress return the tcp address of listen spec
+func tcpAddress(spec string) (string, bool) {
+	if strings.HasPrefix(spec, schemeUnix) || strings.HasPrefix(spec, schemeFD) {
+		return "", false
+	}
+	return strings.TrimPrefix(spec, schemeTCP), true
+}
+
+func listenUnix(path, socketMode string) (net.Listener, error) {
+	mode := os.FileMode(defaultUnixSocketMode)
+	if len(socketMode) > 0 {
+		m, err := strconv.ParseUint(socketMode, 8, 32)
+		if err != nil {
+			return nil, fmt.Errorf("unix socket mode is not octal: %s", socketMode)
+		}
+		mode = os.FileMode(m)
+	}
+
+	// remove the socket left by last run
+	if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
+
+func listenFD(spec string) (net.Listener, error) {
+	fd, err := strconv.Atoi(spec)
+	if err != nil {
+		return nil, fmt.Errorf("listen fd is not int: %s", spec)
+	}
+
+	// check systemd socket activation env if it is set
+	if pid := os.Getenv("LISTEN_PID"); len(pid) > 0 && pid != strconv.Itoa(os.Getpid()) {
+		return nil, fmt.Errorf("listen fds are passed to other process: %s", pid)
+	}
+	if fds := os.Getenv("LISTEN_FDS"); len(fds) > 0 {
+		n, err := strconv.Atoi(fds)
+		if err != nil {
+			return nil, fmt.Errorf("LISTEN_FDS is not int: %s", fds)
+		}
+		if fd < listenFDsStart || fd >= listenFDsStart+n {
+			return nil, fmt.Errorf("fd %d is not in LISTEN_FDS: %d", fd, n)
+		}
+	}
+
+	f := os.NewFile(uintptr(fd), "listen-fd-"+spec)
+	if f == nil {
+		return nil, fmt.Errorf("invalid listen fd: %d", fd)
+	}
+	// net.FileListener dup the fd, close the origin one
+	defer f.Close()
+
+	return net.FileListener(f)
+}
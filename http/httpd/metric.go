@@ -0,0 +1,185 @@
+package httpd
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/lostyear/go-toolkits/http/middlewares/prommetric"
+	"github.com/lostyear/go-toolkits/metrics"
+)
+
+// httpMetrics report requests, timeouts and panics of an engine to one monitor system,
+// the timeout and recovery middlewares report to the same metrics as the metric middleware.
+type httpMetrics interface {
+	Middleware() gin.HandlerFunc
+	ObserveTimeout(r *http.Request, status int, elapsed time.Duration)
+	ObservePanic(c *gin.Context, err interface{}, brokenPipe bool)
+}
+
+// newHTTPMetrics create http metrics by the backend of metric middleware in pipeline,
+// prom reports by prommetric, n9e by n9emetric client, others by metrics package.
+// it returns nil if metric middleware is disabled or no backend configured.
+// metrics are owned by the engine, the closer is called when the engine is replaced.
+func newHTTPMetrics(cfg Config) (httpMetrics, io.Closer, error) {
+	pipeline := cfg.Middlewares
+	if len(pipeline) <= 0 {
+		pipeline = defaultPipeline
+	}
+	for _, mc := range pipeline {
+		if mc.Name != MiddlewareMetric || mc.Disable {
+			continue
+		}
+
+		backend := cfg.Metric
+		if v, ok := mc.Options["backend"]; ok {
+			backend = v
+		}
+		switch backend {
+		case "":
+			return nil, nil, nil
+		case MetricPrometheus:
+			// collectors are registered once and shared by engines
+			m, err := promMetrics(cfg, mc.Options)
+			return m, nil, err
+		case MetricN9e:
+			cli, err := n9eClient(cfg, mc.Options)
+			if err != nil {
+				return nil, nil, err
+			}
+			return cli, cli, nil
+		default:
+			b, err := metrics.New(metrics.Config{
+				Backend:    backend,
+				Namespace:  optionOr(mc.Options, "namespace", cfg.MetricNamespace),
+				StatsdAddr: optionOr(mc.Options, "statsd_addr", cfg.MetricStatsdAddr),
+			})
+			if err != nil {
+				return nil, nil, err
+			}
+			closer, _ := b.(io.Closer)
+			return newFacadeMetrics(b), closer, nil
+		}
+	}
+	return nil, nil, nil
+}
+
+// facadeMetrics report requests by a backend of metrics package
+type facadeMetrics struct {
+	requests    metrics.Counter
+	duration    metrics.Histogram
+	statusClass metrics.Counter
+	inFlight    metrics.Gauge
+	timeouts    metrics.Counter
+	panics      metrics.Counter
+}
+
+func newFacadeMetrics(b metrics.Backend) *facadeMetrics {
+	return &facadeMetrics{
+		requests: b.Counter(metrics.Opts{
+			Name:   "http_server_requests_total",
+			Help:   "http requests by protocol",
+			Labels: []string{"method", "proto"},
+		}),
+		duration: b.Histogram(metrics.Opts{
+			Name:   "http_server_request_duration_ms",
+			Help:   "http request duration in milliseconds",
+			Labels: []string{"method", "route", "status"},
+		}),
+		statusClass: b.Counter(metrics.Opts{
+			Name:   "http_server_responses_total",
+			Help:   "http responses by status class",
+			Labels: []string{"method", "route", "class"},
+		}),
+		inFlight: b.Gauge(metrics.Opts{
+			Name: "http_server_requests_in_flight",
+			Help: "http requests in processing",
+		}),
+		timeouts: b.Counter(metrics.Opts{
+			Name:   "http_server_request_timeouts_total",
+			Help:   "http requests timeout or canceled by client",
+			Labels: []string{"method", "status"},
+		}),
+		panics: b.Counter(metrics.Opts{
+			Name:   "http_server_panics_total",
+			Help:   "panics recovered in http handlers",
+			Labels: []string{"kind"},
+		}),
+	}
+}
+
+// Middleware report requests, scrapes of metric handler are skipped
+func (m *facadeMetrics) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		st := time.Now()
+		m.inFlight.Add(1)
+		defer m.inFlight.Add(-1)
+
+		c.Next()
+
+		if prommetric.IsScrape(c) {
+			return
+		}
+		method := c.Request.Method
+		m.requests.Inc(method, c.Request.Proto)
+
+		code := c.Writer.Status()
+		route := c.FullPath()
+		if len(route) <= 0 {
+			route = prommetric.UnmatchedRoute
+		}
+		m.statusClass.Inc(method, route, statusClass(code))
+		m.duration.Observe(float64(time.Since(st))/float64(time.Millisecond),
+			method, route, strconv.Itoa(code))
+	}
+}
+
+// ObserveTimeout count timeout, it is the hook of timeout middleware
+func (m *facadeMetrics) ObserveTimeout(r *http.Request, status int, elapsed time.Duration) {
+	m.timeouts.Inc(r.Method, strconv.Itoa(status))
+}
+
+// ObservePanic count panic, it is the hook of recovery middleware
+func (m *facadeMetrics) ObservePanic(c *gin.Context, err interface{}, brokenPipe bool) {
+	kind := "panic"
+	if brokenPipe {
+		kind = "broken_pipe"
+	}
+	m.panics.Inc(kind)
+}
+
+func statusClass(status int) string {
+	if status < 100 || status >= 600 {
+		return "other"
+	}
+	return strconv.Itoa(status/100) + "xx"
+}
+
+func (cfg Config) exporterEnabled() bool {
+	return cfg.Metric == MetricPrometheus && len(cfg.MetricListen) > 0
+}
+
+// serveExporter start prometheus exporter, it is stopped with the server
+func (s *Server) serveExporter(cfg Config) error {
+	ln, err := listen(cfg.MetricListen, cfg.UnixSocketMode)
+	if err != nil {
+		return err
+	}
+	exporter, err := prommetric.StartExporter(prommetric.ExporterOptions{
+		Listener: ln,
+		Path:     cfg.MetricPath,
+	})
+	if err != nil {
+		ln.Close()
+		return err
+	}
+
+	s.mu.Lock()
+	s.exporter = exporter
+	s.mu.Unlock()
+
+	return nil
+}
@@ -0,0 +1,445 @@
+package httpd
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/lostyear/go-toolkits/http/middlewares/n9emetric"
+	"github.com/lostyear/go-toolkits/http/middlewares/prommetric"
+	"github.com/lostyear/go-toolkits/http/middlewares/recovery"
+	"github.com/lostyear/go-toolkits/http/middlewares/requestid"
+	"github.com/lostyear/go-toolkits/http/middlewares/requestlog"
+	"github.com/lostyear/go-toolkits/http/middlewares/timeout"
+)
+
+// names of built-in middlewares
+const (
+	MiddlewareRequestID  = "requestid"
+	MiddlewareMetric     = "metric"
+	MiddlewareRequestLog = "requestlog"
+	MiddlewareTimeout    = "timeout"
+	MiddlewareRecovery   = "recovery"
+)
+
+// MiddlewareConfig config a middleware in pipeline, its position is the order in the list
+type MiddlewareConfig struct {
+	Name    string            // built-in or registered middleware name
+	Disable bool              // skip this middleware
+	Options map[string]string // middleware options, empty for values in server config
+}
+
+// MiddlewareFactory create a middleware with server config and its options
+type MiddlewareFactory func(cfg Config, options map[string]string) (gin.HandlerFunc, error)
+
+// MiddlewareCloserFactory create a middleware holding resources like log files,
+// the closer is called when its engine is replaced by reload or server stopped.
+type MiddlewareCloserFactory func(cfg Config, options map[string]string) (gin.HandlerFunc, io.Closer, error)
+
+var (
+	factoryLock sync.RWMutex
+	factories   = map[string]MiddlewareCloserFactory{
+		MiddlewareRequestID:  withoutCloser(requestIDFactory),
+		MiddlewareMetric:     withoutCloser(metricFactory),
+		MiddlewareRequestLog: requestLogFactory,
+		MiddlewareTimeout:    withoutCloser(timeoutFactory),
+		MiddlewareRecovery:   withoutCloser(recoveryFactory),
+	}
+
+	// defaultPipeline is used when no middleware configured
+	defaultPipeline = []MiddlewareConfig{
+		{Name: MiddlewareRequestID},
+		{Name: MiddlewareMetric},
+		{Name: MiddlewareRequestLog},
+		{Name: MiddlewareTimeout},
+		{Name: MiddlewareRecovery},
+	}
+)
+
+// RegisterMiddleware register a middleware factory by name, so it can be used in pipeline config.
+// registering a built-in name replaces the built-in middleware.
+func RegisterMiddleware(name string, factory MiddlewareFactory) {
+	RegisterMiddlewareWithCloser(name, withoutCloser(factory))
+}
+
+// RegisterMiddlewareWithCloser register a middleware factory which returns a closer by name
+func RegisterMiddlewareWithCloser(name string, factory MiddlewareCloserFactory) {
+	factoryLock.Lock()
+	defer factoryLock.Unlock()
+	factories[name] = factory
+}
+
+func withoutCloser(factory MiddlewareFactory) MiddlewareCloserFactory {
+	return func(cfg Config, options map[string]string) (gin.HandlerFunc, io.Closer, error) {
+		h, err := factory(cfg, options)
+		return h, nil, err
+	}
+}
+
+// closers close all in order, the first error is returned
+type closers []io.Closer
+
+func (cs closers) Close() error {
+	var err error
+	for _, c := range cs {
+		if e := c.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// buildPipeline create middlewares in config order, the closer closes resources of them
+func buildPipeline(cfg Config) (gin.HandlersChain, io.Closer, error) {
+	pipeline := cfg.Middlewares
+	if len(pipeline) <= 0 {
+		pipeline = defaultPipeline
+	}
+
+	var cs closers
+	m, closer, err := newHTTPMetrics(cfg)
+	if err != nil {
+		return nil, nil, fmt.Errorf("create middleware %s got error: %s", MiddlewareMetric, err.Error())
+	}
+	if closer != nil {
+		cs = append(cs, closer)
+	}
+	cfg.engineMetrics = m
+
+	factoryLock.RLock()
+	defer factoryLock.RUnlock()
+
+	chain := make(gin.HandlersChain, 0, len(pipeline))
+	for _, mc := range pipeline {
+		if mc.Disable {
+			continue
+		}
+		factory, ok := factories[mc.Name]
+		if !ok {
+			cs.Close()
+			return nil, nil, fmt.Errorf("middleware not registered: %s", mc.Name)
+		}
+		h, closer, err := factory(cfg, mc.Options)
+		if err != nil {
+			cs.Close()
+			return nil, nil, fmt.Errorf("create middleware %s got error: %s", mc.Name, err.Error())
+		}
+		chain = append(chain, h)
+		if closer != nil {
+			cs = append(cs, closer)
+		}
+	}
+	return chain, cs, nil
+}
+
+func requestIDFactory(cfg Config, options map[string]string) (gin.HandlerFunc, error) {
+	return requestid.New(requestid.Options{
+		Header:       options["header"],
+		IgnoreClient: options["ignore_client"] == "true",
+	}), nil
+}
+
+// metricFactory report requests by the metrics of engine, see newHTTPMetrics
+func metricFactory(cfg Config, options map[string]string) (gin.HandlerFunc, error) {
+	if cfg.engineMetrics == nil {
+		return emptyHandler, nil
+	}
+	return cfg.engineMetrics.Middleware(), nil
+}
+
+// promMetrics create prometheus metrics with options:
+// namespace, const_labels as "k=v,k=v", buckets as "ms,ms" and objectives as "q:e,q:e"
+func promMetrics(cfg Config, options map[string]string) (*prommetric.Metrics, error) {
+	opts := prommetric.Options{Namespace: optionOr(options, "namespace", cfg.MetricNamespace)}
+	if v, ok := options["const_labels"]; ok {
+		labels, err := kvOption("const_labels", v)
+		if err != nil {
+			return nil, err
+		}
+		opts.ConstLabels = prometheus.Labels(labels)
+	}
+	if v, ok := options["buckets"]; ok {
+		for _, b := range splitOption(v) {
+			f, err := strconv.ParseFloat(b, 64)
+			if err != nil {
+				return nil, fmt.Errorf("option buckets is not float: %s", b)
+			}
+			opts.Buckets = append(opts.Buckets, f)
+		}
+	}
+	if v, ok := options["objectives"]; ok {
+		opts.Objectives = map[float64]float64{}
+		for _, qe := range splitOption(v) {
+			i := strings.Index(qe, ":")
+			if i <= 0 {
+				return nil, fmt.Errorf("option objectives is not quantile:error: %s", qe)
+			}
+			q, err := strconv.ParseFloat(qe[:i], 64)
+			if err != nil {
+				return nil, fmt.Errorf("option objectives is not float: %s", qe)
+			}
+			e, err := strconv.ParseFloat(qe[i+1:], 64)
+			if err != nil {
+				return nil, fmt.Errorf("option objectives is not float: %s", qe)
+			}
+			opts.Objectives[q] = e
+		}
+	}
+
+	return prommetric.New(opts)
+}
+
+func requestLogFactory(cfg Config, options map[string]string) (gin.HandlerFunc, io.Closer, error) {
+	path := cfg.LogPath
+	if v, ok := options["path"]; ok {
+		path = v
+	}
+	rotationHours, err := uintOption(options, "rotation_hours", cfg.LogRotationHours)
+	if err != nil {
+		return nil, nil, err
+	}
+	maxDays, err := uintOption(options, "max_days", cfg.LogMaxDays)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	opts := requestlog.Options{
+		Format:    cfg.LogFormat,
+		Fields:    cfg.LogFields,
+		UserIDKey: cfg.LogUserIDKey,
+	}
+	if v, ok := options["format"]; ok {
+		opts.Format = v
+	}
+	if v, ok := options["fields"]; ok {
+		opts.Fields = splitOption(v)
+	}
+	if v, ok := options["user_id_key"]; ok {
+		opts.UserIDKey = v
+	}
+	if v, ok := options["skip_paths"]; ok {
+		// empty value disables the default skip paths
+		opts.SkipPaths = append([]string{}, splitOption(v)...)
+	}
+	if v, ok := options["sample_rate"]; ok {
+		if opts.SampleRate, err = strconv.ParseFloat(v, 64); err != nil {
+			return nil, nil, fmt.Errorf("option sample_rate is not float: %s", v)
+		}
+	}
+	if opts.SampleBudget, err = intOption(options, "sample_budget", 0); err != nil {
+		return nil, nil, err
+	}
+	if v, ok := options["sample_rules"]; ok {
+		if opts.Rules, err = sampleRules(v); err != nil {
+			return nil, nil, err
+		}
+	}
+	slowMs, err := intOption(options, "slow_ms", 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	opts.SlowThreshold = time.Duration(slowMs) * time.Millisecond
+
+	if v, ok := options["capture"]; ok && v == "true" {
+		opts.Capture = &requestlog.CaptureOptions{
+			Routes:        splitOption(options["capture_routes"]),
+			ContentTypes:  splitOption(options["capture_types"]),
+			RedactFields:  splitOption(options["redact_fields"]),
+			RedactHeaders: splitOption(options["redact_headers"]),
+		}
+		if opts.Capture.MaxBytes, err = intOption(options, "capture_max_bytes", 0); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	opts.Sink = requestlog.SinkOptions{
+		Type:          cfg.LogSink,
+		Path:          path,
+		RotationHours: rotationHours,
+		MaxDays:       maxDays,
+		SyslogNetwork: options["syslog_network"],
+		SyslogAddr:    options["syslog_addr"],
+		SyslogTag:     options["syslog_tag"],
+	}
+	if v, ok := options["sink"]; ok {
+		opts.Sink.Type = v
+	}
+	if opts.Sink.AsyncBuffer, err = intOption(options, "async_buffer", cfg.LogAsyncBuffer); err != nil {
+		return nil, nil, err
+	}
+	if v, ok := options["slow_path"]; ok {
+		slow := opts.Sink
+		slow.Type, slow.Path = requestlog.SinkFile, v
+		opts.SlowSink = &slow
+	}
+
+	// gin default logger is kept if nothing configured
+	if len(opts.Format) <= 0 && len(opts.Sink.Type) <= 0 && len(path) <= 0 && len(options) <= 0 {
+		return gin.Logger(), nil, nil
+	}
+	return requestlog.New(opts)
+}
+
+// sampleRules parse option sample_rules in "pattern:rate:budget,...",
+// rate and budget are parsed from the end since route pattern has colons, like /users/:id:0.1:100.
+func sampleRules(v string) ([]requestlog.Rule, error) {
+	var rules []requestlog.Rule
+	for _, item := range splitOption(v) {
+		i := strings.LastIndex(item, ":")
+		j := -1
+		if i > 0 {
+			j = strings.LastIndex(item[:i], ":")
+		}
+		if j <= 0 {
+			return nil, fmt.Errorf("option sample_rules is not pattern:rate:budget: %s", item)
+		}
+
+		r := requestlog.Rule{Pattern: item[:j]}
+		var err error
+		if r.SampleRate, err = strconv.ParseFloat(item[j+1:i], 64); err != nil {
+			return nil, fmt.Errorf("option sample_rules rate is not float: %s", item)
+		}
+		if r.SampleBudget, err = strconv.Atoi(item[i+1:]); err != nil {
+			return nil, fmt.Errorf("option sample_rules budget is not int: %s", item)
+		}
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+func timeoutFactory(cfg Config, options map[string]string) (gin.HandlerFunc, error) {
+	ms, err := intOption(options, "timeout_ms", cfg.HTTPTimeoutMilliseSecond)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := timeout.DefaultOptions()
+	if opts.Status, err = intOption(options, "status", opts.Status); err != nil {
+		return nil, err
+	}
+	if opts.ClientCancelStatus, err = intOption(options, "client_cancel_status", opts.ClientCancelStatus); err != nil {
+		return nil, err
+	}
+	if cfg.engineMetrics != nil {
+		opts.OnTimeout = cfg.engineMetrics.ObserveTimeout
+	}
+
+	policy := timeout.Policy{
+		Default:              time.Duration(ms) * time.Millisecond,
+		Max:                  time.Duration(cfg.HTTPMaxTimeoutMilliSecond) * time.Millisecond,
+		IgnoreClientDeadline: cfg.HTTPIgnoreClientDeadline,
+	}
+	for route, ms := range cfg.HTTPRouteTimeouts {
+		rt := routeTimeout(route)
+		rt.Timeout = time.Duration(ms) * time.Millisecond
+		policy.Routes = append(policy.Routes, rt)
+	}
+	streams := cfg.HTTPStreamRoutes
+	if v, ok := options["stream_routes"]; ok {
+		streams = splitOption(v)
+	}
+	for _, route := range streams {
+		rt := routeTimeout(route)
+		rt.Stream = true
+		policy.Routes = append(policy.Routes, rt)
+	}
+
+	return timeout.New(opts).PolicyMiddleware(policy), nil
+}
+
+// routeTimeout parse route of timeout policy, it is "METHOD /path" or "/path" for all methods
+func routeTimeout(route string) timeout.RouteTimeout {
+	rt := timeout.RouteTimeout{Path: strings.TrimSpace(route)}
+	if i := strings.Index(rt.Path, " "); i >= 0 {
+		rt.Method, rt.Path = rt.Path[:i], strings.TrimSpace(rt.Path[i+1:])
+	}
+	return rt
+}
+
+func recoveryFactory(cfg Config, options map[string]string) (gin.HandlerFunc, error) {
+	var hook recovery.PanicHook
+	if cfg.engineMetrics != nil {
+		hook = cfg.engineMetrics.ObservePanic
+	}
+	return recovery.WithHook(gin.DefaultErrorWriter, hook), nil
+}
+
+// n9eClient create n9e statsd client with options:
+// statsd_addr, namespace and tags as "k=v,k=v"
+func n9eClient(cfg Config, options map[string]string) (*n9emetric.Client, error) {
+	opts := n9emetric.Options{
+		Addr:      optionOr(options, "statsd_addr", cfg.MetricStatsdAddr),
+		Namespace: optionOr(options, "namespace", cfg.MetricNamespace),
+	}
+	if v, ok := options["tags"]; ok {
+		tags, err := kvOption("tags", v)
+		if err != nil {
+			return nil, err
+		}
+		opts.Tags = tags
+	}
+
+	return n9emetric.NewClient(opts)
+}
+
+// kvOption parse option value in "k=v,k=v"
+func kvOption(key, v string) (map[string]string, error) {
+	kvs := map[string]string{}
+	for _, kv := range splitOption(v) {
+		i := strings.Index(kv, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("option %s is not k=v: %s", key, kv)
+		}
+		kvs[strings.TrimSpace(kv[:i])] = strings.TrimSpace(kv[i+1:])
+	}
+	return kvs, nil
+}
+
+// splitOption split comma separated option value
+func splitOption(v string) []string {
+	var items []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); len(item) > 0 {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// optionOr return the option value, or default value if option not set
+func optionOr(options map[string]string, key, defaultVal string) string {
+	if v, ok := options[key]; ok {
+		return v
+	}
+	return defaultVal
+}
+
+func uintOption(options map[string]string, key string, defaultVal uint) (uint, error) {
+	v, ok := options[key]
+	if !ok {
+		return defaultVal, nil
+	}
+	n, err := strconv.ParseUint(v, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("option %s is not uint: %s", key, v)
+	}
+	return uint(n), nil
+}
+
+func intOption(options map[string]string, key string, defaultVal int) (int, error) {
+	v, ok := options[key]
+	if !ok {
+		return defaultVal, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("option %s is not int: %s", key, v)
+	}
+	return n, nil
+}
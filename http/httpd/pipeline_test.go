@@ -0,0 +1,29 @@
+package httpd
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/lostyear/go-toolkits/http/middlewares/requestlog"
+)
+
+func TestSampleRules(t *testing.T) {
+	rules, err := sampleRules("/users/:id:0.1:100, /static/*:0:5,/ping:1:0")
+	if err != nil {
+		t.Fatalf("parse sample rules got error: %s", err.Error())
+	}
+	want := []requestlog.Rule{
+		{Pattern: "/users/:id", SampleRate: 0.1, SampleBudget: 100},
+		{Pattern: "/static/*", SampleBudget: 5},
+		{Pattern: "/ping", SampleRate: 1},
+	}
+	if !reflect.DeepEqual(rules, want) {
+		t.Errorf("rules = %+v, want %+v", rules, want)
+	}
+
+	for _, v := range []string{"/users", "/users:0.1", ":0.1:1", "/users:x:1", "/users:0.1:x"} {
+		if _, err := sampleRules(v); err == nil {
+			t.Errorf("sample rules %s should fail", v)
+		}
+	}
+}
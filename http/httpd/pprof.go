@@ -0,0 +1,192 @@
+package httpd
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"html"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"runtime"
+	rpprof "runtime/pprof"
+	"runtime/trace"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/lostyear/go-toolkits/http/response"
+)
+
+// profiles are served by runtime/pprof instead of net/http/pprof, since importing
+// net/http/pprof registers handlers on http.DefaultServeMux, which may be public.
+
+const (
+	defaultProfileSeconds = 30
+	defaultTraceSeconds   = 1
+)
+
+func pprofHandler(c *gin.Context) {
+	switch name := strings.TrimPrefix(c.Param("name"), "/"); name {
+	case "":
+		profileIndexHandler(c)
+	case "cmdline":
+		c.Header("Content-Type", "text/plain; charset=utf-8")
+		c.String(http.StatusOK, strings.Join(os.Args, "\x00"))
+	case "profile":
+		cpuProfileHandler(c)
+	case "symbol":
+		symbolHandler(c)
+	case "trace":
+		traceHandler(c)
+	default:
+		namedProfileHandler(c, name)
+	}
+}
+
+// profileIndexHandler list profiles with their counts
+func profileIndexHandler(c *gin.Context) {
+	profiles := rpprof.Profiles()
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i].Name() < profiles[j].Name() })
+
+	var b bytes.Buffer
+	b.WriteString("<html><head><title>/debug/pprof/</title></head><body>\n<p>profiles:</p><table>\n")
+	for _, p := range profiles {
+		name := html.EscapeString(p.Name())
+		fmt.Fprintf(&b, "<tr><td>%d</td><td><a href=\"%s?debug=1\">%s</a></td></tr>\n", p.Count(), name, name)
+	}
+	b.WriteString("<tr><td></td><td><a href=\"profile\">profile</a></td></tr>\n")
+	b.WriteString("<tr><td></td><td><a href=\"trace\">trace</a></td></tr>\n")
+	b.WriteString("</table></body></html>")
+	c.Data(http.StatusOK, "text/html; charset=utf-8", b.Bytes())
+}
+
+// namedProfileHandler write profile like heap and goroutine, debug=1 for text format
+func namedProfileHandler(c *gin.Context, name string) {
+	p := rpprof.Lookup(name)
+	if p == nil {
+		response.JSON(c, http.StatusNotFound, response.NewNotFoundResponse("unknown profile: "+name))
+		return
+	}
+	debug, _ := strconv.Atoi(c.Query("debug"))
+	if name == "heap" && c.Query("gc") != "" {
+		runtime.GC()
+	}
+
+	if debug > 0 {
+		c.Header("Content-Type", "text/plain; charset=utf-8")
+	} else {
+		c.Header("Content-Type", "application/octet-stream")
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	}
+	c.Status(http.StatusOK)
+	p.WriteTo(c.Writer, debug)
+}
+
+// cpuProfileHandler profile cpu for seconds in query, default 30 seconds
+func cpuProfileHandler(c *gin.Context) {
+	d, ok := profileDuration(c, defaultProfileSeconds)
+	if !ok {
+		return
+	}
+
+	// profile is buffered, so that start error can be responded
+	var buf bytes.Buffer
+	if err := rpprof.StartCPUProfile(&buf); err != nil {
+		response.JSON(c, http.StatusInternalServerError, response.NewServerErrorResponse(
+			fmt.Sprintf("could not enable cpu profiling: %s", err.Error()), nil))
+		return
+	}
+	sleep(c, d)
+	rpprof.StopCPUProfile()
+
+	c.Header("Content-Disposition", `attachment; filename="profile"`)
+	c.Data(http.StatusOK, "application/octet-stream", buf.Bytes())
+}
+
+// traceHandler trace execution for seconds in query, default 1 second
+func traceHandler(c *gin.Context) {
+	d, ok := profileDuration(c, defaultTraceSeconds)
+	if !ok {
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := trace.Start(&buf); err != nil {
+		response.JSON(c, http.StatusInternalServerError, response.NewServerErrorResponse(
+			fmt.Sprintf("could not enable tracing: %s", err.Error()), nil))
+		return
+	}
+	sleep(c, d)
+	trace.Stop()
+
+	c.Header("Content-Disposition", `attachment; filename="trace"`)
+	c.Data(http.StatusOK, "application/octet-stream", buf.Bytes())
+}
+
+func profileDuration(c *gin.Context, defaultSeconds float64) (time.Duration, bool) {
+	sec := defaultSeconds
+	if v := c.Query("seconds"); len(v) > 0 {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f <= 0 {
+			response.JSON(c, http.StatusBadRequest, response.NewBadRequestResponse("invalid seconds: "+v))
+			return 0, false
+		}
+		sec = f
+	}
+	return time.Duration(sec * float64(time.Second)), true
+}
+
+// sleep until duration passed or client gone
+func sleep(c *gin.Context, d time.Duration) {
+	select {
+	case <-time.After(d):
+	case <-c.Request.Context().Done():
+	}
+}
+
+// symbolHandler look up function names of program counters, like net/http/pprof.
+// addresses are in hex joined by +, from query of GET or body of POST.
+func symbolHandler(c *gin.Context) {
+	var b bytes.Buffer
+	// pprof only checks whether symbols are available
+	b.WriteString("num_symbols: 1\n")
+
+	var r *bufio.Reader
+	if c.Request.Method == http.MethodPost {
+		body, _ := ioutil.ReadAll(c.Request.Body)
+		r = bufio.NewReader(bytes.NewReader(body))
+	} else {
+		r = bufio.NewReader(strings.NewReader(c.Request.URL.RawQuery))
+	}
+	for {
+		word, err := r.ReadSlice('+')
+		if err == nil {
+			word = word[:len(word)-1]
+		}
+		pc, _ := strconv.ParseUint(string(word), 0, 64)
+		if pc != 0 {
+			if f := runtime.FuncForPC(uintptr(pc)); f != nil {
+				fmt.Fprintf(&b, "%#x %s\n", pc, f.Name())
+			}
+		}
+		if err != nil {
+			break
+		}
+	}
+	c.Data(http.StatusOK, "text/plain; charset=utf-8", b.Bytes())
+}
+
+// varsHandler serve command line and memory stats in the format of expvar,
+// vars published by expvar are not included since expvar is not imported.
+func varsHandler(c *gin.Context) {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	c.JSON(http.StatusOK, gin.H{
+		"cmdline":  os.Args,
+		"memstats": stats,
+	})
+}
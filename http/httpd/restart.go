@@ -0,0 +1,65 @@
+package httpd
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"syscall"
+
+	"github.com/fvbock/endless"
+)
+
+// startEndless serve requests by endless, which handles signals by itself:
+// SIGHUP and SIGUSR2 fork a child process with listening socket inherited,
+// the old process finishes requests in flight and exit when child started;
+// SIGINT and SIGTERM drain connections within shutdown timeout.
+func (s *Server) startEndless(cfg Config) error {
+	addr, ok := tcpAddress(cfg.Listen)
+	if !ok {
+		return fmt.Errorf("graceful restart only support tcp address: %s", cfg.Listen)
+	}
+
+	es := endless.NewServer(addr, s.srv.Handler)
+	es.ConnContext = s.srv.ConnContext
+	es.TLSConfig = s.srv.TLSConfig
+	es.TLSNextProto = s.srv.TLSNextProto
+	es.MaxHeaderBytes = s.srv.MaxHeaderBytes
+	es.ReadTimeout = s.srv.ReadTimeout
+	es.ReadHeaderTimeout = s.srv.ReadHeaderTimeout
+	es.IdleTimeout = s.srv.IdleTimeout
+	es.WriteTimeout = s.srv.WriteTimeout
+	// endless hammers the server on SIGUSR2, we fork instead
+	es.SignalHooks[endless.PRE_SIGNAL][syscall.SIGUSR2] = append(
+		es.SignalHooks[endless.PRE_SIGNAL][syscall.SIGUSR2],
+		func() {
+			if err := syscall.Kill(syscall.Getpid(), syscall.SIGHUP); err != nil {
+				log.Printf("restart http server got error: %s\n", err.Error())
+			}
+		},
+	)
+	endless.DefaultHammerTime = s.shutdownTimeout()
+
+	s.mu.Lock()
+	s.srv = &es.Server
+	s.mu.Unlock()
+
+	go func() {
+		var err error
+		if es.TLSConfig != nil {
+			// endless loads the key pair as static certificate, it is not served
+			// since GetConfigForClient of tls config returns the reloaded one.
+			err = es.ListenAndServeTLS(cfg.TLSCertFile, cfg.TLSKeyFile)
+		} else {
+			err = es.ListenAndServe()
+		}
+		// endless closes listener to stop accepting, it is a normal exit
+		if ne, ok := err.(*net.OpError); ok && ne.Op == "accept" {
+			err = http.ErrServerClosed
+		}
+		s.serveErr = err
+		close(s.done)
+	}()
+
+	return nil
+}
@@ -0,0 +1,203 @@
+package httpd
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/lostyear/go-toolkits/http/response"
+)
+
+// Route is a route declared by controller
+type Route struct {
+	Method      string
+	Path        string
+	Handler     gin.HandlerFunc
+	Timeout     time.Duration     // timeout of this route applied by server timeout middleware, 0 for server timeout
+	Middlewares gin.HandlersChain // middlewares run before the handler
+	Stream      bool              // streaming route like chunked download, sse or websocket, served without timeout
+}
+
+// Controller declares its routes
+type Controller interface {
+	Routes() []Route
+}
+
+// RouteGroup is a group of routes under same prefix and middlewares
+type RouteGroup struct {
+	Prefix      string
+	Middlewares gin.HandlersChain
+	Routes      []Route
+}
+
+// RouteInfo describes a registered route
+type RouteInfo struct {
+	Method    string  `json:"method"`
+	Path      string  `json:"path"`
+	Handler   string  `json:"handler"`
+	TimeoutMs float64 `json:"timeout_ms,omitempty"`
+}
+
+// NewRouteGroup create a group with prefix and middlewares
+func NewRouteGroup(prefix string, middlewares ...gin.HandlerFunc) *RouteGroup {
+	return &RouteGroup{
+		Prefix:      prefix,
+		Middlewares: middlewares,
+	}
+}
+
+// APIVersion create a versioned group with prefix /api/{version}, version is like v1
+func APIVersion(version string, middlewares ...gin.HandlerFunc) *RouteGroup {
+	return NewRouteGroup("/api/"+version, middlewares...)
+}
+
+// Handle add a route to group
+func (g *RouteGroup) Handle(method, path string, handler gin.HandlerFunc, middlewares ...gin.HandlerFunc) *RouteGroup {
+	return g.Add(Route{
+		Method:      method,
+		Path:        path,
+		Handler:     handler,
+		Middlewares: middlewares,
+	})
+}
+
+// Add routes to group
+func (g *RouteGroup) Add(routes ...Route) *RouteGroup {
+	g.Routes = append(g.Routes, routes...)
+	return g
+}
+
+// AddController add all routes declared by controllers
+func (g *RouteGroup) AddController(ctls ...Controller) *RouteGroup {
+	for _, ctl := range ctls {
+		g.Add(ctl.Routes()...)
+	}
+	return g
+}
+
+// Register routes of group to router, it returns infos of registered routes.
+// route timeouts are not applied here, server passes them to its timeout middleware.
+func (g *RouteGroup) Register(router gin.IRouter) []RouteInfo {
+	rg := router.Group(g.Prefix, g.Middlewares...)
+
+	infos := make([]RouteInfo, 0, len(g.Routes))
+	for _, r := range g.Routes {
+		handlers := make(gin.HandlersChain, 0, len(r.Middlewares)+1)
+		handlers = append(handlers, r.Middlewares...)
+		handlers = append(handlers, r.Handler)
+		rg.Handle(strings.ToUpper(r.Method), r.Path, handlers...)
+
+		infos = append(infos, RouteInfo{
+			Method:    strings.ToUpper(r.Method),
+			Path:      joinPath(rg.BasePath(), r.Path),
+			TimeoutMs: float64(r.Timeout) / float64(time.Millisecond),
+		})
+	}
+	return infos
+}
+
+// withRouteTimeouts return config with timeouts of group routes added to HTTPRouteTimeouts
+// and streaming routes added to HTTPStreamRoutes. routes in config take precedence,
+// a config key without method overrides group routes of all methods on the path.
+func withRouteTimeouts(cfg Config, groups []*RouteGroup) Config {
+	// routes of config, keyed by "METHOD /path" and " /path" for all methods
+	configured := make(map[string]bool, len(cfg.HTTPRouteTimeouts))
+	for route := range cfg.HTTPRouteTimeouts {
+		rt := routeTimeout(route)
+		configured[strings.ToUpper(rt.Method)+" "+rt.Path] = true
+	}
+	overridden := func(method, path string) bool {
+		return configured[method+" "+path] || configured[" "+path]
+	}
+
+	timeouts := make(map[string]int, len(cfg.HTTPRouteTimeouts))
+	var streams []string
+	for _, g := range groups {
+		base := joinPath("/", g.Prefix)
+		for _, r := range g.Routes {
+			method, path := strings.ToUpper(r.Method), joinPath(base, r.Path)
+			if overridden(method, path) {
+				continue
+			}
+			route := method + " " + path
+			if r.Timeout > 0 {
+				timeouts[route] = int(r.Timeout / time.Millisecond)
+			}
+			if r.Stream {
+				streams = append(streams, route)
+			}
+		}
+	}
+	if len(timeouts) > 0 {
+		for route, ms := range cfg.HTTPRouteTimeouts {
+			timeouts[route] = ms
+		}
+		cfg.HTTPRouteTimeouts = timeouts
+	}
+	if len(streams) > 0 {
+		cfg.HTTPStreamRoutes = append(streams, cfg.HTTPStreamRoutes...)
+	}
+	return cfg
+}
+
+// routeTable list engine routes with their timeouts,
+// timeouts is keyed by "METHOD /path" or "/path" like HTTPRouteTimeouts.
+func routeTable(eng *gin.Engine, timeouts map[string]int) []RouteInfo {
+	routes := eng.Routes()
+	table := make([]RouteInfo, 0, len(routes))
+	for _, r := range routes {
+		ms, ok := timeouts[r.Method+" "+r.Path]
+		if !ok {
+			ms = timeouts[r.Path]
+		}
+		table = append(table, RouteInfo{
+			Method:    r.Method,
+			Path:      r.Path,
+			Handler:   r.Handler,
+			TimeoutMs: float64(ms),
+		})
+	}
+	sort.Slice(table, func(i, j int) bool {
+		if table[i].Path != table[j].Path {
+			return table[i].Path < table[j].Path
+		}
+		return table[i].Method < table[j].Method
+	})
+	return table
+}
+
+// DumpRoutes write route table to writer, one route per line
+func DumpRoutes(w io.Writer, table []RouteInfo) {
+	for _, r := range table {
+		timeout := "-"
+		if r.TimeoutMs > 0 {
+			timeout = fmt.Sprintf("%vms", r.TimeoutMs)
+		}
+		fmt.Fprintf(w, "[route] %-7s %-40s timeout: %-8s --> %s\n", r.Method, r.Path, timeout, r.Handler)
+	}
+}
+
+// RouteTableHandler serve route table in default response
+func RouteTableHandler(table func() []RouteInfo) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		response.JSON(c, http.StatusOK, response.NewOKResonseData(table()))
+	}
+}
+
+// joinPath is same as gin joinPaths, keep the trailing slash
+func joinPath(base, relative string) string {
+	if len(relative) <= 0 {
+		return base
+	}
+	p := path.Join(base, relative)
+	if strings.HasSuffix(relative, "/") && !strings.HasSuffix(p, "/") {
+		return p + "/"
+	}
+	return p
+}
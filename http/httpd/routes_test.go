@@ -0,0 +1,40 @@
+package httpd
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWithRouteTimeouts(t *testing.T) {
+	groups := []*RouteGroup{{
+		Prefix: "/api/v1",
+		Routes: []Route{
+			{Method: "GET", Path: "/x", Timeout: 2 * time.Second},
+			{Method: "post", Path: "/x", Timeout: 3 * time.Second},
+			{Method: "GET", Path: "/y", Timeout: time.Second},
+			{Method: "GET", Path: "/events", Stream: true},
+			{Method: "GET", Path: "/download", Stream: true},
+		},
+	}}
+	cfg := withRouteTimeouts(Config{
+		HTTPRouteTimeouts: map[string]int{
+			"/api/v1/x":            500, // overrides group routes of all methods
+			"GET /api/v1/y":        600,
+			"GET /api/v1/download": 700,
+		},
+	}, groups)
+
+	wantTimeouts := map[string]int{
+		"/api/v1/x":            500,
+		"GET /api/v1/y":        600,
+		"GET /api/v1/download": 700,
+	}
+	if !reflect.DeepEqual(cfg.HTTPRouteTimeouts, wantTimeouts) {
+		t.Errorf("route timeouts = %v, want %v", cfg.HTTPRouteTimeouts, wantTimeouts)
+	}
+	wantStreams := []string{"GET /api/v1/events"}
+	if !reflect.DeepEqual(cfg.HTTPStreamRoutes, wantStreams) {
+		t.Errorf("stream routes = %v, want %v", cfg.HTTPStreamRoutes, wantStreams)
+	}
+}
@@ -0,0 +1,436 @@
+package httpd
+
+import (
+	"context"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/lostyear/go-toolkits/http/middlewares/prommetric"
+)
+
+// ConfigLoader load the newest config, it is called when server got SIGHUP
+type ConfigLoader func() (Config, error)
+
+// Server is a http server which owns its engine and http.Server.
+// config can be reloaded while serving, it will not drop any connection.
+type Server struct {
+	mu     sync.RWMutex
+	cfg    Config
+	eng    *gin.Engine
+	routes []RouteInfo
+	closer io.Closer // close resources of engine middlewares
+
+	handler     RegisterHandler
+	middlewares gin.HandlersChain
+	loader      ConfigLoader
+	health      *Health
+	groups      []*RouteGroup
+
+	srv      *http.Server
+	ln       net.Listener
+	admin    *adminServer
+	exporter *prommetric.Exporter
+	done     chan struct{}
+	serveErr error
+}
+
+type connContextKey struct{}
+
+const defaultShutdownTimeout = 10 * time.Second
+
+// New create a server with config, handler should have all route regist action,
+// and all middlewares will be used after the config pipeline.
+// the engine is built when server start.
+func New(cfg Config, handler RegisterHandler, middlewares gin.HandlersChain) *Server {
+	s := &Server{
+		cfg:         cfg,
+		handler:     handler,
+		middlewares: middlewares,
+		health:      NewHealth(),
+		done:        make(chan struct{}),
+	}
+	s.srv = &http.Server{
+		Addr:    cfg.Listen,
+		Handler: s,
+		ConnContext: func(ctx context.Context, c net.Conn) context.Context {
+			return context.WithValue(ctx, connContextKey{}, c)
+		},
+	}
+
+	return s
+}
+
+// SetConfigLoader set the loader used to reload config on SIGHUP
+func (s *Server) SetConfigLoader(loader ConfigLoader) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.loader = loader
+}
+
+// Health return the health of server, components can add checks to it.
+// it is served at /healthz for liveness and /readyz for readiness.
+func (s *Server) Health() *Health {
+	return s.health
+}
+
+// AddRouteGroups add route groups to server, they are registered when server start
+func (s *Server) AddRouteGroups(groups ...*RouteGroup) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.groups = append(s.groups, groups...)
+}
+
+// RouteTable return all routes served by server
+func (s *Server) RouteTable() []RouteInfo {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.routes
+}
+
+// Config return the config server using now
+func (s *Server) Config() Config {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.cfg
+}
+
+// ServeHTTP dispatch request to the engine built from current config
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	eng, cfg := s.eng, s.cfg
+	s.mu.RUnlock()
+
+	// timeouts are also set per request, so that reloading them will not touch
+	// the fields of http.Server which are read by connections concurrently.
+	if c, ok := r.Context().Value(connContextKey{}).(net.Conn); ok && r.ProtoMajor == 1 {
+		now := time.Now()
+		if cfg.ReadTimeoutMilliseSecond > 0 {
+			c.SetReadDeadline(now.Add(time.Duration(cfg.ReadTimeoutMilliseSecond) * time.Millisecond))
+		}
+		if cfg.WriteTimeoutMilliseSecond > 0 {
+			c.SetWriteDeadline(now.Add(time.Duration(cfg.WriteTimeoutMilliseSecond) * time.Millisecond))
+		}
+	}
+
+	eng.ServeHTTP(w, r)
+}
+
+// Start listen on config address and serve requests in background.
+// listen error is returned directly, use ":0" to listen on a random port
+// and get it by Addr.
+// the address can be tcp://host:port, unix:///path.sock or fd://3, default is tcp.
+// http/2 is served with tls, or on plain listener if h2c is enabled.
+// admin server and prometheus exporter are started with it if their addresses configured.
+// it serves https when tls certificate configured.
+// in graceful restart mode, the listen error is returned by Wait.
+func (s *Server) Start() (err error) {
+	cfg := s.Config()
+	eng, routes, closer, err := s.newEngine(cfg)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.eng, s.routes, s.closer = eng, routes, closer
+	s.mu.Unlock()
+	defer func() {
+		if err != nil && closer != nil {
+			closer.Close()
+			s.mu.Lock()
+			s.closer = nil
+			s.mu.Unlock()
+		}
+	}()
+	if cfg.DumpRoutes {
+		DumpRoutes(log.Writer(), routes)
+	}
+
+	if cfg.tlsEnabled() {
+		tlsCfg, err := newTLSConfig(cfg)
+		if err != nil {
+			return err
+		}
+		s.srv.TLSConfig = tlsCfg
+	}
+	s.configureTimeouts(cfg)
+	if err := s.configureHTTP2(cfg); err != nil {
+		return err
+	}
+	var adminEng *gin.Engine
+	if len(cfg.AdminListen) > 0 {
+		if adminEng, err = s.newAdminEngine(cfg); err != nil {
+			return err
+		}
+	}
+	if cfg.GracefulRestart {
+		if adminEng != nil {
+			s.serveBackground("admin", func() error { return s.serveAdmin(cfg, adminEng) })
+		}
+		if cfg.exporterEnabled() {
+			s.serveBackground("metric", func() error { return s.serveExporter(cfg) })
+		}
+		return s.startEndless(cfg)
+	}
+
+	ln, err := listen(cfg.Listen, cfg.UnixSocketMode)
+	if err != nil {
+		return err
+	}
+	if adminEng != nil {
+		if err := s.serveAdmin(cfg, adminEng); err != nil {
+			ln.Close()
+			return err
+		}
+	}
+	if cfg.exporterEnabled() {
+		if err := s.serveExporter(cfg); err != nil {
+			ln.Close()
+			s.stopSideServers(context.Background())
+			return err
+		}
+	}
+
+	s.mu.Lock()
+	s.ln = ln
+	s.mu.Unlock()
+
+	go func() {
+		if s.srv.TLSConfig != nil {
+			// certificates are got from tls config
+			s.serveErr = s.srv.ServeTLS(ln, "", "")
+		} else {
+			s.serveErr = s.srv.Serve(ln)
+		}
+		close(s.done)
+	}()
+
+	return nil
+}
+
+// Wait block until the server stopped, it returns the serve error,
+// which is http.ErrServerClosed after Stop.
+func (s *Server) Wait() error {
+	<-s.done
+	return s.serveErr
+}
+
+// AdminAddr return the address admin server listening on,
+// it returns empty string if admin server not started.
+func (s *Server) AdminAddr() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.admin != nil {
+		return s.admin.ln.Addr().String()
+	}
+	return ""
+}
+
+// MetricAddr return the address prometheus exporter listening on,
+// it returns empty string if exporter not started.
+func (s *Server) MetricAddr() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.exporter != nil {
+		return s.exporter.Addr()
+	}
+	return ""
+}
+
+// Addr return the address server listening on,
+// it returns config address if server not started.
+func (s *Server) Addr() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.ln != nil {
+		return s.ln.Addr().String()
+	}
+	return s.cfg.Listen
+}
+
+// ListenAndServe listen on config address and serve requests,
+// it blocks until the server stopped.
+func (s *Server) ListenAndServe() error {
+	if err := s.Start(); err != nil {
+		return err
+	}
+	return s.Wait()
+}
+
+// Run serve requests and handle signals until the server stopped.
+// SIGINT and SIGTERM will drain connections within shutdown timeout,
+// SIGHUP will reload config by the config loader.
+// in graceful restart mode, SIGHUP and SIGUSR2 restart the process instead.
+func (s *Server) Run() error {
+	if err := s.Start(); err != nil {
+		return err
+	}
+	if s.Config().GracefulRestart {
+		return s.Wait()
+	}
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(sigCh)
+
+	for {
+		select {
+		case <-s.done:
+			return s.serveErr
+		case sig := <-sigCh:
+			if sig == syscall.SIGHUP {
+				if err := s.reload(); err != nil {
+					log.Printf("reload http server config got error: %s\n", err.Error())
+				}
+				continue
+			}
+			return s.Stop(s.shutdownTimeout())
+		}
+	}
+}
+
+// Reload apply the config to server, the listen address can not be changed.
+// requests in flight will finish with the old config.
+func (s *Server) Reload(cfg Config) error {
+	eng, routes, closer, err := s.newEngine(cfg)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if cfg.Listen != s.cfg.Listen {
+		log.Printf("http server listen address can not be reloaded, keep using %s\n", s.cfg.Listen)
+		cfg.Listen = s.cfg.Listen
+	}
+	s.cfg = cfg
+	old := s.closer
+	s.eng, s.routes, s.closer = eng, routes, closer
+
+	// requests in flight may still use the old engine
+	if old != nil {
+		time.AfterFunc(s.shutdownTimeoutLocked(), func() {
+			if err := old.Close(); err != nil {
+				log.Printf("close middlewares of old engine got error: %s\n", err.Error())
+			}
+		})
+	}
+	return nil
+}
+
+func (s *Server) reload() error {
+	s.mu.RLock()
+	loader := s.loader
+	s.mu.RUnlock()
+	if loader == nil {
+		return nil
+	}
+
+	cfg, err := loader()
+	if err != nil {
+		return err
+	}
+	return s.Reload(cfg)
+}
+
+// Stop the server with timeout, it waits for all connections done.
+// readiness fails while draining.
+func (s *Server) Stop(timeout time.Duration) error {
+	s.health.SetDraining(true)
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	s.mu.RLock()
+	srv := s.srv
+	s.mu.RUnlock()
+
+	err := srv.Shutdown(ctx)
+	if e := s.stopSideServers(ctx); e != nil && err == nil {
+		err = e
+	}
+
+	s.mu.RLock()
+	closer := s.closer
+	s.mu.RUnlock()
+	if closer != nil {
+		if e := closer.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// configureTimeouts set timeouts of http.Server from config,
+// they limit reading request header and idle keep-alive connections before
+// a request reaches ServeHTTP, and http/2 streams which have no per request deadline.
+// they are not changed by Reload.
+func (s *Server) configureTimeouts(cfg Config) {
+	read := time.Duration(cfg.ReadTimeoutMilliseSecond) * time.Millisecond
+	s.srv.ReadTimeout = read
+	s.srv.ReadHeaderTimeout = read
+	s.srv.IdleTimeout = read
+	s.srv.WriteTimeout = time.Duration(cfg.WriteTimeoutMilliseSecond) * time.Millisecond
+}
+
+// stopSideServers stop admin server and metric exporter
+func (s *Server) stopSideServers(ctx context.Context) error {
+	s.mu.RLock()
+	admin, exporter := s.admin, s.exporter
+	s.mu.RUnlock()
+
+	var err error
+	if admin != nil {
+		err = admin.stop(ctx)
+	}
+	if exporter != nil {
+		if e := exporter.Stop(ctx); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+func (s *Server) shutdownTimeout() time.Duration {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.shutdownTimeoutLocked()
+}
+
+func (s *Server) shutdownTimeoutLocked() time.Duration {
+	if s.cfg.ShutdownTimeoutMilliseSecond <= 0 {
+		return defaultShutdownTimeout
+	}
+	return time.Duration(s.cfg.ShutdownTimeoutMilliseSecond) * time.Millisecond
+}
+
+func (s *Server) newEngine(cfg Config) (*gin.Engine, []RouteInfo, io.Closer, error) {
+	s.mu.RLock()
+	groups := s.groups
+	s.mu.RUnlock()
+
+	// route timeouts are served by the timeout middleware in pipeline
+	cfg = withRouteTimeouts(cfg, groups)
+	eng, closer, err := newEngine(cfg, s.handler, s.middlewares)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	for _, g := range groups {
+		g.Register(eng)
+	}
+
+	registerHealth(eng, s.health)
+	if len(cfg.RouteDebugPath) > 0 {
+		eng.GET(cfg.RouteDebugPath, RouteTableHandler(s.RouteTable))
+	}
+
+	return eng, routeTable(eng, cfg.HTTPRouteTimeouts), closer, nil
+}
@@ -0,0 +1,126 @@
+package httpd
+
+import (
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+func pingHandler(name string) RegisterHandler {
+	return func(eng *gin.Engine) {
+		eng.GET("/ping", func(c *gin.Context) {
+			c.String(http.StatusOK, name)
+		})
+	}
+}
+
+// startServer start a server on random port of loopback
+func startServer(t *testing.T, cfg Config, handler RegisterHandler) *Server {
+	if len(cfg.Listen) <= 0 {
+		cfg.Listen = "127.0.0.1:0"
+	}
+	s := New(cfg, handler, nil)
+	if err := s.Start(); err != nil {
+		t.Fatalf("start server got error: %s", err.Error())
+	}
+	return s
+}
+
+func get(client *http.Client, url string) (int, string, error) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	return resp.StatusCode, string(body), err
+}
+
+func TestServersStopOneByOne(t *testing.T) {
+	first := startServer(t, Config{}, pingHandler("first"))
+	second := startServer(t, Config{}, pingHandler("second"))
+	if first.Addr() == second.Addr() {
+		t.Fatalf("servers listen on same address: %s", first.Addr())
+	}
+
+	// no keep-alive, so stopped server is not reached by an idle connection
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}, Timeout: time.Second}
+	for _, s := range []struct {
+		srv  *Server
+		name string
+	}{{first, "first"}, {second, "second"}} {
+		code, body, err := get(client, "http://"+s.srv.Addr()+"/ping")
+		if err != nil {
+			t.Fatalf("request %s server got error: %s", s.name, err.Error())
+		}
+		if code != http.StatusOK || body != s.name {
+			t.Errorf("%s server responded %d %s", s.name, code, body)
+		}
+	}
+
+	if err := first.Stop(time.Second); err != nil {
+		t.Fatalf("stop first server got error: %s", err.Error())
+	}
+	if err := first.Wait(); err != http.ErrServerClosed {
+		t.Errorf("first server wait = %v, want %v", err, http.ErrServerClosed)
+	}
+	if _, _, err := get(client, "http://"+first.Addr()+"/ping"); err == nil {
+		t.Error("first server still serves after stop")
+	}
+	if code, body, err := get(client, "http://"+second.Addr()+"/ping"); err != nil || body != "second" {
+		t.Errorf("second server responded %d %s %v after first stopped", code, body, err)
+	}
+
+	if err := second.Stop(time.Second); err != nil {
+		t.Fatalf("stop second server got error: %s", err.Error())
+	}
+	if err := second.Wait(); err != http.ErrServerClosed {
+		t.Errorf("second server wait = %v, want %v", err, http.ErrServerClosed)
+	}
+}
+
+func TestServerStartListenError(t *testing.T) {
+	s := startServer(t, Config{}, pingHandler("first"))
+	defer s.Stop(time.Second)
+
+	other := New(Config{Listen: s.Addr()}, pingHandler("other"), nil)
+	if err := other.Start(); err == nil {
+		other.Stop(time.Second)
+		t.Fatalf("start on used address %s should fail", s.Addr())
+	}
+}
+
+func TestServerReload(t *testing.T) {
+	s := startServer(t, Config{HTTPTimeoutMilliseSecond: 50}, func(eng *gin.Engine) {
+		eng.GET("/slow", func(c *gin.Context) {
+			time.Sleep(100 * time.Millisecond)
+			c.String(http.StatusOK, "done")
+		})
+	})
+	defer s.Stop(time.Second)
+
+	url := "http://" + s.Addr() + "/slow"
+	if code, _, err := get(http.DefaultClient, url); err != nil || code != http.StatusGatewayTimeout {
+		t.Fatalf("slow request responded %d %v, want %d", code, err, http.StatusGatewayTimeout)
+	}
+
+	cfg := s.Config()
+	cfg.HTTPTimeoutMilliseSecond = 1000
+	cfg.Listen = "127.0.0.1:1"
+	if err := s.Reload(cfg); err != nil {
+		t.Fatalf("reload got error: %s", err.Error())
+	}
+	if s.Config().Listen == cfg.Listen {
+		t.Error("listen address should not be reloaded")
+	}
+	if code, body, err := get(http.DefaultClient, url); err != nil || code != http.StatusOK {
+		t.Errorf("slow request responded %d %s %v after reload", code, body, err)
+	}
+}
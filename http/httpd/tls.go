@@ -0,0 +1,196 @@
+package httpd
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// certificate files are checked at most once in this interval
+const certCheckInterval = 5 * time.Second
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+func (cfg Config) tlsEnabled() bool {
+	return len(cfg.TLSCertFile) > 0 && len(cfg.TLSKeyFile) > 0
+}
+
+// newTLSConfig create tls config from server config,
+// certificate and client ca will be reloaded when the files changed.
+func newTLSConfig(cfg Config) (*tls.Config, error) {
+	minVersion := uint16(tls.VersionTLS12)
+	if len(cfg.TLSMinVersion) > 0 {
+		v, ok := tlsVersions[cfg.TLSMinVersion]
+		if !ok {
+			return nil, fmt.Errorf("tls min version not supported: %s", cfg.TLSMinVersion)
+		}
+		minVersion = v
+	}
+
+	ciphers, err := cipherSuites(cfg.TLSCipherSuites)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &certReloader{
+		certFile: cfg.TLSCertFile,
+		keyFile:  cfg.TLSKeyFile,
+		caFile:   cfg.TLSClientCAFile,
+		base: &tls.Config{
+			MinVersion:   minVersion,
+			CipherSuites: ciphers,
+			NextProtos:   []string{"h2", "http/1.1"},
+		},
+	}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+
+	// every handshake uses the reloaded config, so that certificates set by others
+	// like endless, which are used when client sends no sni, will not be served.
+	tlsCfg := r.base.Clone()
+	tlsCfg.GetCertificate = r.getCertificate
+	tlsCfg.GetConfigForClient = r.getConfigForClient
+	if len(r.caFile) > 0 {
+		tlsCfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return tlsCfg, nil
+}
+
+func cipherSuites(names []string) ([]uint16, error) {
+	if len(names) <= 0 {
+		return nil, nil
+	}
+
+	all := map[string]uint16{}
+	for _, c := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+		all[c.Name] = c.ID
+	}
+
+	ids := make([]uint16, 0, len(names))
+	for _, name := range names {
+		id, ok := all[strings.TrimSpace(name)]
+		if !ok {
+			return nil, fmt.Errorf("tls cipher suite not supported: %s", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+type certReloader struct {
+	certFile string
+	keyFile  string
+	caFile   string
+	base     *tls.Config
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	config  *tls.Config // config with certificate and client ca, used for every handshake
+	modTime time.Time
+	checked time.Time
+}
+
+func (r *certReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.maybeReload()
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+func (r *certReloader) getConfigForClient(*tls.ClientHelloInfo) (*tls.Config, error) {
+	r.maybeReload()
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.config, nil
+}
+
+// maybeReload reload files if they changed, keep using the old ones when got error
+func (r *certReloader) maybeReload() {
+	r.mu.RLock()
+	checked := r.checked
+	r.mu.RUnlock()
+	if time.Since(checked) < certCheckInterval {
+		return
+	}
+
+	r.mu.Lock()
+	r.checked = time.Now()
+	r.mu.Unlock()
+
+	if err := r.load(); err != nil {
+		log.Printf("reload tls certificate got error: %s\n", err.Error())
+	}
+}
+
+func (r *certReloader) load() error {
+	modTime, err := lastModTime(r.certFile, r.keyFile, r.caFile)
+	if err != nil {
+		return err
+	}
+	r.mu.RLock()
+	unchanged := r.cert != nil && !modTime.After(r.modTime)
+	r.mu.RUnlock()
+	if unchanged {
+		return nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("load tls key pair got error: %s", err.Error())
+	}
+
+	config := r.base.Clone()
+	config.Certificates = []tls.Certificate{cert}
+	if len(r.caFile) > 0 {
+		pem, err := ioutil.ReadFile(r.caFile)
+		if err != nil {
+			return fmt.Errorf("read tls client ca got error: %s", err.Error())
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificate found in tls client ca: %s", r.caFile)
+		}
+
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cert = &cert
+	r.config = config
+	r.modTime = modTime
+	return nil
+}
+
+func lastModTime(files ...string) (time.Time, error) {
+	var last time.Time
+	for _, f := range files {
+		if len(f) <= 0 {
+			continue
+		}
+		info, err := os.Stat(f)
+		if err != nil {
+			return last, err
+		}
+		if info.ModTime().After(last) {
+			last = info.ModTime()
+		}
+	}
+	return last, nil
+}
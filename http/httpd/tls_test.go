@@ -0,0 +1,293 @@
+package httpd
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testCert is a certificate generated in test, signed by parent or self signed
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	der  []byte
+}
+
+func newTestCert(t *testing.T, name string, parent *testCert, isCA bool) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key got error: %s", err.Error())
+	}
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		t.Fatalf("generate serial got error: %s", err.Error())
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	if isCA {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+		tmpl.KeyUsage |= x509.KeyUsageCertSign
+	}
+
+	signer, signerKey := tmpl, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatalf("create certificate got error: %s", err.Error())
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("parse certificate got error: %s", err.Error())
+	}
+	return &testCert{cert: cert, key: key, der: der}
+}
+
+// write certificate and key in pem to dir, it returns the file paths
+func (c *testCert) write(t *testing.T, dir, name string) (string, string) {
+	keyDER, err := x509.MarshalECPrivateKey(c.key)
+	if err != nil {
+		t.Fatalf("marshal key got error: %s", err.Error())
+	}
+	certFile := filepath.Join(dir, name+".crt")
+	keyFile := filepath.Join(dir, name+".key")
+	if err := ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.der}), 0600); err != nil {
+		t.Fatalf("write certificate got error: %s", err.Error())
+	}
+	if err := ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatalf("write key got error: %s", err.Error())
+	}
+	return certFile, keyFile
+}
+
+func (c *testCert) pool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(c.cert)
+	return pool
+}
+
+func (c *testCert) tlsCertificate() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{c.der}, PrivateKey: c.key}
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "httpd-tls")
+	if err != nil {
+		t.Fatalf("create temp dir got error: %s", err.Error())
+	}
+	return dir
+}
+
+func tlsClient(cfg *tls.Config) *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{TLSClientConfig: cfg, DisableKeepAlives: true},
+		Timeout:   time.Second,
+	}
+}
+
+func TestServeTLS(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	ca := newTestCert(t, "ca", nil, true)
+	certFile, keyFile := newTestCert(t, "server", ca, false).write(t, dir, "server")
+
+	s := startServer(t, Config{TLSCertFile: certFile, TLSKeyFile: keyFile}, pingHandler("tls"))
+	defer s.Stop(time.Second)
+
+	code, body, err := get(tlsClient(&tls.Config{RootCAs: ca.pool()}), "https://"+s.Addr()+"/ping")
+	if err != nil {
+		t.Fatalf("https request got error: %s", err.Error())
+	}
+	if code != http.StatusOK || body != "tls" {
+		t.Errorf("https request responded %d %s", code, body)
+	}
+
+	// tls 1.1 is below default min version
+	_, _, err = get(tlsClient(&tls.Config{RootCAs: ca.pool(), MaxVersion: tls.VersionTLS11}), "https://"+s.Addr()+"/ping")
+	if err == nil {
+		t.Error("tls 1.1 client should be rejected")
+	}
+}
+
+func TestServeMutualTLS(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	ca := newTestCert(t, "ca", nil, true)
+	certFile, keyFile := newTestCert(t, "server", ca, false).write(t, dir, "server")
+	caFile, _ := ca.write(t, dir, "ca")
+
+	s := startServer(t, Config{
+		TLSCertFile:     certFile,
+		TLSKeyFile:      keyFile,
+		TLSClientCAFile: caFile,
+	}, pingHandler("mtls"))
+	defer s.Stop(time.Second)
+
+	url := "https://" + s.Addr() + "/ping"
+	if _, _, err := get(tlsClient(&tls.Config{RootCAs: ca.pool()}), url); err == nil {
+		t.Error("client without certificate should be rejected")
+	}
+
+	other := newTestCert(t, "other", nil, true)
+	untrusted := newTestCert(t, "client", other, false).tlsCertificate()
+	if _, _, err := get(tlsClient(&tls.Config{RootCAs: ca.pool(), Certificates: []tls.Certificate{untrusted}}), url); err == nil {
+		t.Error("client certificate signed by other ca should be rejected")
+	}
+
+	client := newTestCert(t, "client", ca, false).tlsCertificate()
+	code, body, err := get(tlsClient(&tls.Config{RootCAs: ca.pool(), Certificates: []tls.Certificate{client}}), url)
+	if err != nil {
+		t.Fatalf("mutual tls request got error: %s", err.Error())
+	}
+	if code != http.StatusOK || body != "mtls" {
+		t.Errorf("mutual tls request responded %d %s", code, body)
+	}
+}
+
+func TestNewTLSConfigError(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	certFile, keyFile := newTestCert(t, "server", nil, false).write(t, dir, "server")
+	tests := []Config{
+		{TLSCertFile: certFile, TLSKeyFile: filepath.Join(dir, "missing.key")},
+		{TLSCertFile: certFile, TLSKeyFile: keyFile, TLSMinVersion: "2.0"},
+		{TLSCertFile: certFile, TLSKeyFile: keyFile, TLSCipherSuites: []string{"NOT_A_CIPHER"}},
+		{TLSCertFile: certFile, TLSKeyFile: keyFile, TLSClientCAFile: keyFile},
+	}
+	for i, cfg := range tests {
+		if _, err := newTLSConfig(cfg); err == nil {
+			t.Errorf("config %d should fail", i)
+		}
+	}
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	ca := newTestCert(t, "ca", nil, true)
+	first := newTestCert(t, "first", ca, false)
+	certFile, keyFile := first.write(t, dir, "server")
+	caFile, _ := ca.write(t, dir, "ca")
+
+	r := &certReloader{certFile: certFile, keyFile: keyFile, caFile: caFile, base: &tls.Config{}}
+	if err := r.load(); err != nil {
+		t.Fatalf("load certificate got error: %s", err.Error())
+	}
+	commonName := func() string {
+		// files are checked again only after the interval
+		r.mu.Lock()
+		r.checked = time.Time{}
+		r.mu.Unlock()
+
+		cert, err := r.getCertificate(nil)
+		if err != nil {
+			t.Fatalf("get certificate got error: %s", err.Error())
+		}
+		parsed, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			t.Fatalf("parse certificate got error: %s", err.Error())
+		}
+		return parsed.Subject.CommonName
+	}
+	if name := commonName(); name != "first" {
+		t.Fatalf("certificate = %s, want first", name)
+	}
+
+	// replace files with a newer certificate
+	newTestCert(t, "second", ca, false).write(t, dir, "server")
+	future := time.Now().Add(time.Minute)
+	for _, f := range []string{certFile, keyFile} {
+		if err := os.Chtimes(f, future, future); err != nil {
+			t.Fatalf("touch %s got error: %s", f, err.Error())
+		}
+	}
+	if name := commonName(); name != "second" {
+		t.Errorf("certificate = %s after reload, want second", name)
+	}
+	config, err := r.getConfigForClient(nil)
+	if err != nil || config == nil || config.ClientCAs == nil {
+		t.Fatalf("mutual tls config = %v, %v", config, err)
+	}
+	if len(config.Certificates) != 1 {
+		t.Fatalf("mutual tls config has %d certificates, want 1", len(config.Certificates))
+	}
+	if parsed, err := x509.ParseCertificate(config.Certificates[0].Certificate[0]); err != nil ||
+		parsed.Subject.CommonName != "second" {
+		t.Errorf("mutual tls config does not use reloaded certificate")
+	}
+
+	// broken files keep the old certificate
+	if err := ioutil.WriteFile(keyFile, []byte("broken"), 0600); err != nil {
+		t.Fatalf("write key got error: %s", err.Error())
+	}
+	later := future.Add(time.Minute)
+	os.Chtimes(keyFile, later, later)
+	if name := commonName(); name != "second" {
+		t.Errorf("certificate = %s after broken reload, want second", name)
+	}
+}
+
+// endless sets a static certificate loaded from files, go serves it to clients
+// without sni, reloaded certificate should be served instead.
+func TestStaticCertificateNotServed(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	ca := newTestCert(t, "ca", nil, true)
+	certFile, keyFile := newTestCert(t, "reloaded", ca, false).write(t, dir, "server")
+	tlsCfg, err := newTLSConfig(Config{TLSCertFile: certFile, TLSKeyFile: keyFile})
+	if err != nil {
+		t.Fatalf("create tls config got error: %s", err.Error())
+	}
+	config := tlsCfg.Clone()
+	config.Certificates = []tls.Certificate{newTestCert(t, "static", ca, false).tlsCertificate()}
+
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", config)
+	if err != nil {
+		t.Fatalf("listen got error: %s", err.Error())
+	}
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		conn.(*tls.Conn).Handshake()
+		conn.Close()
+	}()
+
+	// no sni is sent when connecting by ip
+	conn, err := tls.Dial("tcp", ln.Addr().String(), &tls.Config{RootCAs: ca.pool()})
+	if err != nil {
+		t.Fatalf("dial got error: %s", err.Error())
+	}
+	defer conn.Close()
+	if name := conn.ConnectionState().PeerCertificates[0].Subject.CommonName; name != "reloaded" {
+		t.Errorf("certificate = %s, want reloaded", name)
+	}
+}
@@ -0,0 +1,25 @@
+package n9emetric
+
+import (
+	"github.com/lostyear/go-toolkits/metrics/n9e"
+)
+
+// DefaultAddr is the default address of n9e statsd agent
+const DefaultAddr = n9e.DefaultAddr
+
+// Options of statsd client
+type Options = n9e.Options
+
+// Client send metrics to n9e statsd agent by udp, it reports requests by Middleware
+type Client struct {
+	*n9e.Client
+}
+
+// NewClient create a client, address is resolved here
+func NewClient(opts Options) (*Client, error) {
+	cli, err := n9e.NewClient(opts)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{Client: cli}, nil
+}
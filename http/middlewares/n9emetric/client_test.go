@@ -0,0 +1,73 @@
+package n9emetric
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestClientMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// local udp stand-in of statsd agent
+	agent, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("listen udp got error: %s", err.Error())
+	}
+	defer agent.Close()
+
+	cli, err := NewClient(Options{Addr: agent.LocalAddr().String(), Namespace: "api"})
+	if err != nil {
+		t.Fatalf("create client got error: %s", err.Error())
+	}
+	defer cli.Close()
+
+	eng := gin.New()
+	eng.Use(cli.Middleware())
+	eng.GET("/users/:id", func(c *gin.Context) {
+		c.String(http.StatusCreated, "ok")
+	})
+
+	tests := []struct {
+		path   string
+		callee string
+		code   string
+	}{
+		{path: "/users/42", callee: "callee=/users/:id", code: ",201"},
+		{path: "/not/found", callee: "callee=" + UnmatchedRoute, code: ",404"},
+	}
+	for _, tt := range tests {
+		eng.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+		buf := make([]byte, 4096)
+		agent.SetReadDeadline(time.Now().Add(time.Second))
+		n, err := agent.Read(buf)
+		if err != nil {
+			t.Fatalf("%s: read packet got error: %s", tt.path, err.Error())
+		}
+		lines := strings.Split(string(buf[:n]), "\n")
+		if len(lines) < 3 {
+			t.Fatalf("%s: packet too short: %q", tt.path, lines)
+		}
+		if !strings.HasSuffix(lines[0], tt.code) {
+			t.Errorf("%s: value = %s, want status %s", tt.path, lines[0], tt.code)
+		}
+		if lines[1] != "api/"+requestMetric {
+			t.Errorf("%s: metric = %s, want api/%s", tt.path, lines[1], requestMetric)
+		}
+		if lines[len(lines)-1] != "rpc" {
+			t.Errorf("%s: aggregator = %s, want rpc", tt.path, lines[len(lines)-1])
+		}
+		tags := strings.Join(lines[2:len(lines)-1], "|")
+		for _, want := range []string{tt.callee, "method=GET", "proto=HTTP/1.1"} {
+			if !strings.Contains(tags, want) {
+				t.Errorf("%s: tags %s should contain %s", tt.path, tags, want)
+			}
+		}
+	}
+}
@@ -1,30 +1,77 @@
 package n9emetric
 
 import (
+	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	statsd "github.com/n9e/metrics-go/statsdlib"
 )
 
+// UnmatchedRoute is the callee of requests which match no route
+const UnmatchedRoute = "unmatched"
+
+// metrics reported by client
+const (
+	requestMetric = "http.request"
+	timeoutMetric = "http.request.timeout"
+	panicMetric   = "http.request.panic"
+)
+
 // MetricMiddleware is a gin framework middleware.
-// it will report metric to n9e monitor system
+// it will report metric to n9e monitor system,
+// statsd address and namespace are read from files in working directory by statsdlib.
 func MetricMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		st := time.Now()
 
 		c.Next()
 
-		caller := c.HandlerName()
-		callee := c.Request.RequestURI
-		method := c.Request.Method
-		status := c.Request.Response.StatusCode
-		latency := time.Since(st)
-
 		statsd.RpcMetric(
-			"http.request",
-			caller, callee, latency, status,
-			map[string]string{"method": method},
+			requestMetric,
+			c.HandlerName(), callee(c), time.Since(st), c.Writer.Status(),
+			map[string]string{"method": c.Request.Method, "proto": c.Request.Proto},
 		)
 	}
 }
+
+// Middleware is a gin framework middleware report request metrics by the client,
+// requests are reported with route template as callee.
+func (cli *Client) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		st := time.Now()
+
+		c.Next()
+
+		// metrics are best effort, report error is ignored like statsdlib
+		cli.Rpc(
+			requestMetric,
+			c.HandlerName(), callee(c), time.Since(st), c.Writer.Status(),
+			map[string]string{"method": c.Request.Method, "proto": c.Request.Proto},
+		)
+	}
+}
+
+// ObserveTimeout count a request timeout or canceled by client,
+// it can be used as OnTimeout of timeout middleware options.
+func (cli *Client) ObserveTimeout(r *http.Request, status int, elapsed time.Duration) {
+	cli.Counter(timeoutMetric, 1, map[string]string{"method": r.Method, "status": strconv.Itoa(status)})
+}
+
+// ObservePanic count a panic recovered, broken pipe is counted separately since it is client abort,
+// it can be used as the hook of recovery middleware.
+func (cli *Client) ObservePanic(c *gin.Context, err interface{}, brokenPipe bool) {
+	kind := "panic"
+	if brokenPipe {
+		kind = "broken_pipe"
+	}
+	cli.Counter(panicMetric, 1, map[string]string{"kind": kind})
+}
+
+func callee(c *gin.Context) string {
+	if route := c.FullPath(); len(route) > 0 {
+		return route
+	}
+	return UnmatchedRoute
+}
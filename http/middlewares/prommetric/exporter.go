@@ -0,0 +1,119 @@
+package prommetric
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ExporterOptions of metric exporter
+type ExporterOptions struct {
+	Addr     string              // listen address
+	Listener net.Listener        // serve on this listener instead of listening on address
+	Path     string              // metric path, default /metrics
+	Gatherer prometheus.Gatherer // default prometheus.DefaultGatherer
+
+	TLSCertFile string // serve https when both cert and key file set
+	TLSKeyFile  string // tls private key file
+
+	BasicAuthUser     string // require basic auth when user set
+	BasicAuthPassword string // password of basic auth
+}
+
+// Exporter is a http server serving prometheus metrics
+type Exporter struct {
+	srv  *http.Server
+	ln   net.Listener
+	done chan struct{}
+	err  error
+}
+
+// StartExporter listen on address and serve metrics in background,
+// listen and certificate errors are returned directly.
+func StartExporter(opts ExporterOptions) (*Exporter, error) {
+	if len(opts.Path) <= 0 {
+		opts.Path = "/metrics"
+	}
+	if opts.Gatherer == nil {
+		opts.Gatherer = prometheus.DefaultGatherer
+	}
+
+	handler := gathererHandler(opts.Gatherer)
+	if len(opts.BasicAuthUser) > 0 {
+		handler = basicAuth(opts.BasicAuthUser, opts.BasicAuthPassword, handler)
+	}
+	mux := http.NewServeMux()
+	mux.Handle(opts.Path, handler)
+
+	srv := &http.Server{Handler: mux}
+	if len(opts.TLSCertFile) > 0 && len(opts.TLSKeyFile) > 0 {
+		cert, err := tls.LoadX509KeyPair(opts.TLSCertFile, opts.TLSKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load metric exporter certificate got error: %s", err.Error())
+		}
+		srv.TLSConfig = &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			MinVersion:   tls.VersionTLS12,
+		}
+	}
+
+	ln := opts.Listener
+	if ln == nil {
+		var err error
+		if ln, err = net.Listen("tcp", opts.Addr); err != nil {
+			return nil, err
+		}
+	}
+
+	e := &Exporter{
+		srv:  srv,
+		ln:   ln,
+		done: make(chan struct{}),
+	}
+	go func() {
+		if srv.TLSConfig != nil {
+			e.err = srv.ServeTLS(ln, "", "")
+		} else {
+			e.err = srv.Serve(ln)
+		}
+		close(e.done)
+	}()
+
+	return e, nil
+}
+
+// Addr return the address exporter listening on
+func (e *Exporter) Addr() string {
+	return e.ln.Addr().String()
+}
+
+// Wait block until the exporter stopped, it returns the serve error,
+// which is http.ErrServerClosed after Stop.
+func (e *Exporter) Wait() error {
+	<-e.done
+	return e.err
+}
+
+// Stop the exporter, it waits for scrapes in flight until ctx done
+func (e *Exporter) Stop(ctx context.Context) error {
+	return e.srv.Shutdown(ctx)
+}
+
+func basicAuth(user, password string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u, p, ok := r.BasicAuth()
+		if !ok ||
+			subtle.ConstantTimeCompare([]byte(u), []byte(user)) != 1 ||
+			subtle.ConstantTimeCompare([]byte(p), []byte(password)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="metrics"`)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -1,119 +1,308 @@
 package prommetric
 
 import (
+	"net/http"
 	"strconv"
 	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
+// scrapeKey marks scrape requests in gin context
+const scrapeKey = "prommetric/scrape"
+
+// UnmatchedRoute is the route label of requests which match no route,
+// so that random paths will not explode label cardinality.
+const UnmatchedRoute = "unmatched"
+
 var (
-	httpCounter = promauto.NewCounterVec(
-		prometheus.CounterOpts{
-			Namespace: "http",
-			Subsystem: "requests",
-			Name:      "total_counter",
-			Help:      "request counter",
-		},
-		[]string{"method"},
-	)
-	httpHistogram = promauto.NewHistogramVec(
-		prometheus.HistogramOpts{
-			Namespace: "http",
-			Subsystem: "requests",
-			Name:      "latency_histogram",
-			Help:      "http latency",
-		},
-		[]string{"method", "handler", "status"},
-	)
-	httpSummary = promauto.NewSummaryVec(
-		prometheus.SummaryOpts{
-			Namespace: "http",
-			Subsystem: "requests",
-			Name:      "latency_summary",
-			Help:      "http latency",
-		},
-		[]string{"method", "handler", "status"},
-	)
-	httpReqSummary = promauto.NewSummaryVec(
-		prometheus.SummaryOpts{
-			Namespace: "http",
-			Subsystem: "requests",
-			Name:      "size_summary",
-			Help:      "http request size",
-		},
-		[]string{"method", "handler", "status"},
-	)
-	httpResSummary = promauto.NewSummaryVec(
-		prometheus.SummaryOpts{
-			Namespace: "http",
-			Subsystem: "response",
-			Name:      "size_summary",
-			Help:      "http response size",
-		},
-		[]string{"method", "handler", "status"},
-	)
-
-	metricHandlerPath = ""
+	// DefaultBuckets of latency histogram in milliseconds
+	DefaultBuckets = []float64{1, 5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000}
+	// DefaultObjectives of summaries
+	DefaultObjectives = map[float64]float64{0.5: 0.05, 0.9: 0.01, 0.99: 0.001}
+
+	defaultMetrics     *Metrics
+	defaultMetricsOnce sync.Once
 )
 
+// Options of metrics
+type Options struct {
+	Registerer  prometheus.Registerer // default prometheus.DefaultRegisterer
+	Namespace   string                // default http
+	ConstLabels prometheus.Labels     // labels added to all metrics
+	Buckets     []float64             // latency histogram buckets in milliseconds
+	Objectives  map[float64]float64   // quantiles of summaries
+}
+
+// Metrics is a set of http metrics registered to a registerer
+type Metrics struct {
+	counter    *prometheus.CounterVec
+	histogram  *prometheus.HistogramVec
+	summary    *prometheus.SummaryVec
+	reqSummary *prometheus.SummaryVec
+	resSummary *prometheus.SummaryVec
+
+	inFlight    prometheus.Gauge
+	statusClass *prometheus.CounterVec
+	timeouts    *prometheus.CounterVec
+	panics      *prometheus.CounterVec
+}
+
+// New create metrics and register them, metrics already registered with same
+// options are reused, so multiple servers can share a registerer.
+// it returns error if they are registered with other buckets or objectives.
+func New(opts Options) (*Metrics, error) {
+	if opts.Registerer == nil {
+		opts.Registerer = prometheus.DefaultRegisterer
+	}
+	if len(opts.Namespace) <= 0 {
+		opts.Namespace = "http"
+	}
+	if len(opts.Buckets) <= 0 {
+		opts.Buckets = DefaultBuckets
+	}
+	if len(opts.Objectives) <= 0 {
+		opts.Objectives = DefaultObjectives
+	}
+
+	labels := []string{"method", "route", "status"}
+	m := &Metrics{
+		counter: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace:   opts.Namespace,
+				Subsystem:   "requests",
+				Name:        "total_counter",
+				Help:        "request counter",
+				ConstLabels: opts.ConstLabels,
+			},
+			[]string{"method", "proto"},
+		),
+		histogram: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace:   opts.Namespace,
+				Subsystem:   "requests",
+				Name:        "latency_histogram",
+				Help:        "http latency",
+				ConstLabels: opts.ConstLabels,
+				Buckets:     opts.Buckets,
+			},
+			labels,
+		),
+		summary: prometheus.NewSummaryVec(
+			prometheus.SummaryOpts{
+				Namespace:   opts.Namespace,
+				Subsystem:   "requests",
+				Name:        "latency_summary",
+				Help:        "http latency",
+				ConstLabels: opts.ConstLabels,
+				Objectives:  opts.Objectives,
+			},
+			labels,
+		),
+		reqSummary: prometheus.NewSummaryVec(
+			prometheus.SummaryOpts{
+				Namespace:   opts.Namespace,
+				Subsystem:   "requests",
+				Name:        "size_summary",
+				Help:        "http request size",
+				ConstLabels: opts.ConstLabels,
+				Objectives:  opts.Objectives,
+			},
+			labels,
+		),
+		resSummary: prometheus.NewSummaryVec(
+			prometheus.SummaryOpts{
+				Namespace:   opts.Namespace,
+				Subsystem:   "response",
+				Name:        "size_summary",
+				Help:        "http response size",
+				ConstLabels: opts.ConstLabels,
+				Objectives:  opts.Objectives,
+			},
+			labels,
+		),
+		inFlight: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Namespace:   opts.Namespace,
+				Subsystem:   "requests",
+				Name:        "in_flight",
+				Help:        "requests in processing",
+				ConstLabels: opts.ConstLabels,
+			},
+		),
+		statusClass: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace:   opts.Namespace,
+				Subsystem:   "response",
+				Name:        "status_class_counter",
+				Help:        "response counter by status class",
+				ConstLabels: opts.ConstLabels,
+			},
+			[]string{"method", "route", "class"},
+		),
+		timeouts: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace:   opts.Namespace,
+				Subsystem:   "requests",
+				Name:        "timeout_counter",
+				Help:        "requests timeout or canceled by client",
+				ConstLabels: opts.ConstLabels,
+			},
+			[]string{"method", "status"},
+		),
+		panics: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace:   opts.Namespace,
+				Subsystem:   "requests",
+				Name:        "panic_counter",
+				Help:        "panics recovered in handlers",
+				ConstLabels: opts.ConstLabels,
+			},
+			[]string{"kind"},
+		),
+	}
+
+	var err error
+	if m.counter, err = registerCounterVec(opts.Registerer, m.counter); err != nil {
+		return nil, err
+	}
+	for _, cv := range []**prometheus.CounterVec{&m.statusClass, &m.timeouts, &m.panics} {
+		if *cv, err = registerCounterVec(opts.Registerer, *cv); err != nil {
+			return nil, err
+		}
+	}
+	if m.inFlight, err = registerGauge(opts.Registerer, m.inFlight); err != nil {
+		return nil, err
+	}
+	if m.histogram, err = registerHistogramVec(opts.Registerer, m.histogram, opts.Buckets); err != nil {
+		return nil, err
+	}
+	for _, s := range []**prometheus.SummaryVec{&m.summary, &m.reqSummary, &m.resSummary} {
+		if *s, err = registerSummaryVec(opts.Registerer, *s, opts.Objectives); err != nil {
+			return nil, err
+		}
+	}
+
+	return m, nil
+}
+
+// Default return metrics registered to prometheus default registerer
+func Default() *Metrics {
+	defaultMetricsOnce.Do(func() {
+		m, err := New(Options{})
+		if err != nil {
+			panic(err)
+		}
+		defaultMetrics = m
+	})
+	return defaultMetrics
+}
+
 // MetricMiddleware is a gin framework middleware.
 // it will support metric for prometheus monitor system
 func MetricMiddleware() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		if metricHandlerPath == c.Request.RequestURI {
-			return
-		}
+	return Default().Middleware()
+}
 
+// Middleware is a gin framework middleware record request metrics,
+// requests are labeled by route template.
+func (m *Metrics) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
 		st := time.Now()
-		method := c.Request.Method
-		httpCounter.WithLabelValues(method).Inc()
+		m.inFlight.Inc()
+		defer m.inFlight.Dec()
 
 		c.Next()
 
-		status := strconv.Itoa(c.Writer.Status())
-		handler := c.HandlerName()
-		// uri := c.Request.RequestURI
+		// scrape requests are not counted
+		if IsScrape(c) {
+			return
+		}
+		method := c.Request.Method
+		m.counter.WithLabelValues(method, c.Request.Proto).Inc()
+
+		code := c.Writer.Status()
+		status := strconv.Itoa(code)
+		route := c.FullPath()
+		if len(route) <= 0 {
+			route = UnmatchedRoute
+		}
+		m.statusClass.WithLabelValues(method, route, statusClass(code)).Inc()
 		reqSz := float64(c.Request.ContentLength)
 		resSz := float64(c.Writer.Size())
 		latency := float64(time.Since(st)) / float64(time.Millisecond)
 
-		httpHistogram.WithLabelValues(method, handler, status).Observe(latency)
-		httpSummary.WithLabelValues(method, handler, status).Observe(latency)
-		httpReqSummary.WithLabelValues(method, handler, status).Observe(reqSz)
-		httpResSummary.WithLabelValues(method, handler, status).Observe(resSz)
+		m.histogram.WithLabelValues(method, route, status).Observe(latency)
+		m.summary.WithLabelValues(method, route, status).Observe(latency)
+		m.reqSummary.WithLabelValues(method, route, status).Observe(reqSz)
+		m.resSummary.WithLabelValues(method, route, status).Observe(resSz)
+	}
+}
+
+// ObserveTimeout count a request timeout or canceled by client,
+// it can be used as OnTimeout of timeout middleware options.
+func (m *Metrics) ObserveTimeout(r *http.Request, status int, elapsed time.Duration) {
+	m.timeouts.WithLabelValues(r.Method, strconv.Itoa(status)).Inc()
+}
+
+// ObservePanic count a panic recovered, broken pipe is counted separately since it is client abort,
+// it can be used as the hook of recovery middleware.
+func (m *Metrics) ObservePanic(c *gin.Context, err interface{}, brokenPipe bool) {
+	kind := "panic"
+	if brokenPipe {
+		kind = "broken_pipe"
 	}
+	m.panics.WithLabelValues(kind).Inc()
+}
+
+func statusClass(status int) string {
+	if status < 100 || status >= 600 {
+		return "other"
+	}
+	return strconv.Itoa(status/100) + "xx"
+}
+
+// IsScrape check whether the request is served by metric handler,
+// other metric middlewares can use it to skip scrapes.
+func IsScrape(c *gin.Context) bool {
+	return c.GetBool(scrapeKey)
 }
 
 // MetricHandler return a gin handler function to handler prometheus metric
 func MetricHandler() gin.HandlerFunc {
-	handler := promhttp.Handler()
+	return GathererHandler(prometheus.DefaultGatherer)
+}
+
+// GathererHandler return a gin handler function serve metrics of the gatherer,
+// it is used with a custom registry.
+// requests served by it are skipped by metric middleware.
+func GathererHandler(g prometheus.Gatherer) gin.HandlerFunc {
+	handler := gathererHandler(g)
 	return func(c *gin.Context) {
+		c.Set(scrapeKey, true)
 		handler.ServeHTTP(c.Writer, c.Request)
 	}
 }
 
-var runServer sync.Once
+// gathererHandler serve metrics of the gatherer, scrapes of default gatherer are instrumented like promhttp.Handler
+func gathererHandler(g prometheus.Gatherer) http.Handler {
+	handler := promhttp.HandlerFor(g, promhttp.HandlerOpts{})
+	if g == prometheus.DefaultGatherer {
+		return promhttp.InstrumentMetricHandler(prometheus.DefaultRegisterer, handler)
+	}
+	return handler
+}
 
-// StartSingleServer start a http server to handle prometheus metric request
-func StartSingleServer(addr, path string) {
-	runServer.Do(func() {
-		eng := gin.New()
-		eng.Use(gin.RecoveryWithWriter(emptyWriter{}))
-		eng.GET(path, MetricHandler())
-		eng.Run(addr)
-	})
+// StartSingleServer start a http server to handle prometheus metric request in background,
+// listen error is returned, use Stop of the exporter to shut it down.
+func StartSingleServer(addr, path string) (*Exporter, error) {
+	return StartExporter(ExporterOptions{Addr: addr, Path: path})
 }
 
 // StartDefaultServer start a http server to handle prometheus metric request with default exporter
-func StartDefaultServer() {
-	StartSingleServer(":9090", "/metrics")
+func StartDefaultServer() (*Exporter, error) {
+	return StartSingleServer(":9090", "/metrics")
 }
-
-type emptyWriter struct{}
-
-func (emptyWriter) Write([]byte) (int, error) { return 0, nil }
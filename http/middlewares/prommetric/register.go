@@ -0,0 +1,104 @@
+package prommetric
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// buckets and objectives are not part of metric desc, so they are recorded
+// to check metrics already registered are created with same options.
+var (
+	optionsLock       sync.Mutex
+	histogramBuckets  = map[*prometheus.HistogramVec][]float64{}
+	summaryObjectives = map[*prometheus.SummaryVec]map[float64]float64{}
+)
+
+// register collector, return the registered one if it already exists.
+// histograms and summaries are reused only if they have same buckets or objectives.
+
+func registerCounterVec(r prometheus.Registerer, c *prometheus.CounterVec) (*prometheus.CounterVec, error) {
+	existing, err := register(r, c)
+	if err != nil {
+		return nil, err
+	}
+	if v, ok := existing.(*prometheus.CounterVec); ok {
+		return v, nil
+	}
+	return nil, fmt.Errorf("metric registered with other type: %T", existing)
+}
+
+func registerGauge(r prometheus.Registerer, c prometheus.Gauge) (prometheus.Gauge, error) {
+	existing, err := register(r, c)
+	if err != nil {
+		return nil, err
+	}
+	if v, ok := existing.(prometheus.Gauge); ok {
+		return v, nil
+	}
+	return nil, fmt.Errorf("metric registered with other type: %T", existing)
+}
+
+func registerHistogramVec(r prometheus.Registerer, c *prometheus.HistogramVec, buckets []float64) (*prometheus.HistogramVec, error) {
+	optionsLock.Lock()
+	defer optionsLock.Unlock()
+
+	existing, err := register(r, c)
+	if err != nil {
+		return nil, err
+	}
+	v, ok := existing.(*prometheus.HistogramVec)
+	if !ok {
+		return nil, fmt.Errorf("metric registered with other type: %T", existing)
+	}
+	if v == c {
+		histogramBuckets[v] = buckets
+		return v, nil
+	}
+	old, ok := histogramBuckets[v]
+	if !ok {
+		return nil, fmt.Errorf("histogram registered by others, buckets unknown")
+	}
+	if !reflect.DeepEqual(old, buckets) {
+		return nil, fmt.Errorf("histogram registered with other buckets: %v", old)
+	}
+	return v, nil
+}
+
+func registerSummaryVec(r prometheus.Registerer, c *prometheus.SummaryVec, objectives map[float64]float64) (*prometheus.SummaryVec, error) {
+	optionsLock.Lock()
+	defer optionsLock.Unlock()
+
+	existing, err := register(r, c)
+	if err != nil {
+		return nil, err
+	}
+	v, ok := existing.(*prometheus.SummaryVec)
+	if !ok {
+		return nil, fmt.Errorf("metric registered with other type: %T", existing)
+	}
+	if v == c {
+		summaryObjectives[v] = objectives
+		return v, nil
+	}
+	old, ok := summaryObjectives[v]
+	if !ok {
+		return nil, fmt.Errorf("summary registered by others, objectives unknown")
+	}
+	if !reflect.DeepEqual(old, objectives) {
+		return nil, fmt.Errorf("summary registered with other objectives: %v", old)
+	}
+	return v, nil
+}
+
+func register(r prometheus.Registerer, c prometheus.Collector) (prometheus.Collector, error) {
+	if err := r.Register(c); err != nil {
+		if are, ok := err.(prometheus.AlreadyRegisteredError); ok {
+			return are.ExistingCollector, nil
+		}
+		return nil, err
+	}
+	return c, nil
+}
@@ -15,6 +15,7 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/lostyear/go-toolkits/http/middlewares/requestid"
 	"github.com/lostyear/go-toolkits/http/response"
 )
 
@@ -34,8 +35,17 @@ func Recovery() gin.HandlerFunc {
 	return WithWriter(gin.DefaultErrorWriter)
 }
 
+// PanicHook is called when a panic recovered, brokenPipe is true when client closed the connection.
+// panics of response.HTTPError are not passed to the hook since they are normal responses.
+type PanicHook func(c *gin.Context, err interface{}, brokenPipe bool)
+
 // WithWriter returns a middleware for a given writer that recovers from any panics and writes a 500 if there was one.
 func WithWriter(out io.Writer) gin.HandlerFunc {
+	return WithHook(out, nil)
+}
+
+// WithHook returns a recovery middleware like WithWriter, and calls hook with every panic recovered.
+func WithHook(out io.Writer, hook PanicHook) gin.HandlerFunc {
 	var logger *log.Logger
 	if out != nil {
 		logger = log.New(out, "\n\n\x1b[31m", log.Ldate|log.Ltime|log.Lmicroseconds)
@@ -45,11 +55,10 @@ func WithWriter(out io.Writer) gin.HandlerFunc {
 			if err := recover(); err != nil {
 				// custom http error
 				if e, ok := err.(response.HTTPError); ok {
-					c.JSON(e.Code(), response.DefaultResponse{
+					response.AbortWithJSON(c, e.Code(), &response.DefaultResponse{
 						Status:  e.Code(),
 						Message: e.Error(),
 					})
-					c.Abort()
 					return
 				}
 				// Check for a broken connection, as it is not really a
@@ -62,8 +71,12 @@ func WithWriter(out io.Writer) gin.HandlerFunc {
 						}
 					}
 				}
+				if hook != nil {
+					hook(c, err, brokenPipe)
+				}
 				if logger != nil {
 					stack := stack(3)
+					id := requestid.Get(c)
 					httpRequest, _ := httputil.DumpRequest(c.Request, false)
 					headers := strings.Split(string(httpRequest), "\r\n")
 					for idx, header := range headers {
@@ -73,13 +86,13 @@ func WithWriter(out io.Writer) gin.HandlerFunc {
 						}
 					}
 					if brokenPipe {
-						logger.Printf("%s\n%s%s", err, string(httpRequest), reset)
+						logger.Printf("[request_id=%s] %s\n%s%s", id, err, string(httpRequest), reset)
 					} else if gin.IsDebugging() {
-						logger.Printf("[Recovery] %s panic recovered:\n%s\n%s\n%s%s",
-							timeFormat(time.Now()), strings.Join(headers, "\r\n"), err, stack, reset)
+						logger.Printf("[Recovery] %s [request_id=%s] panic recovered:\n%s\n%s\n%s%s",
+							timeFormat(time.Now()), id, strings.Join(headers, "\r\n"), err, stack, reset)
 					} else {
-						logger.Printf("[Recovery] %s panic recovered:\n%s\n%s%s",
-							timeFormat(time.Now()), err, stack, reset)
+						logger.Printf("[Recovery] %s [request_id=%s] panic recovered:\n%s\n%s%s",
+							timeFormat(time.Now()), id, err, stack, reset)
 					}
 				}
 
@@ -87,21 +100,12 @@ func WithWriter(out io.Writer) gin.HandlerFunc {
 				if brokenPipe {
 					c.Error(err.(error)) // nolint: errcheck
 					c.Abort()
-				} else if e, ok := err.(error); ok {
-					c.JSON(http.StatusInternalServerError, response.DefaultResponse{
+				} else {
+					// message of error or any other panic value
+					response.AbortWithJSON(c, http.StatusInternalServerError, &response.DefaultResponse{
 						Status:  http.StatusInternalServerError,
-						Message: e.Error(),
+						Message: fmt.Sprintf("%v", err),
 					})
-					c.Abort()
-				} else {
-					c.JSON(
-						http.StatusInternalServerError,
-						gin.H{
-							"status":  http.StatusInternalServerError,
-							"message": fmt.Sprintf("%v", err),
-						},
-					)
-					c.Abort()
 				}
 			}
 		}()
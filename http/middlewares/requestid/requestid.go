@@ -0,0 +1,95 @@
+package requestid
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/lostyear/go-toolkits/requestctx"
+)
+
+// HeaderRequestID is the default header of request id
+const HeaderRequestID = "X-Request-ID"
+
+// Key is the key of request id in gin context
+const Key = "requestid"
+
+// maxLength of incoming request id, longer one is replaced
+const maxLength = 128
+
+// Options of request id middleware
+type Options struct {
+	Header       string        // header of request id, default X-Request-ID
+	Generator    func() string // generate request id, default Generate
+	IgnoreClient bool          // always generate request id even if client sends one
+}
+
+// Middleware accept request id of client or generate one,
+// it is stored in gin context and request context, and echoed in response header.
+// request context keeps it by requestctx, so that packages without gin can read it.
+func Middleware() gin.HandlerFunc {
+	return New(Options{})
+}
+
+// New create request id middleware with options
+func New(opts Options) gin.HandlerFunc {
+	if len(opts.Header) <= 0 {
+		opts.Header = HeaderRequestID
+	}
+	if opts.Generator == nil {
+		opts.Generator = Generate
+	}
+
+	return func(c *gin.Context) {
+		id := ""
+		if !opts.IgnoreClient {
+			id = c.GetHeader(opts.Header)
+		}
+		if !valid(id) {
+			id = opts.Generator()
+		}
+
+		c.Set(Key, id)
+		c.Request = c.Request.WithContext(requestctx.NewContext(c.Request.Context(), id))
+		c.Header(opts.Header, id)
+
+		c.Next()
+	}
+}
+
+// Get return request id in gin context, it falls back to request context
+func Get(c *gin.Context) string {
+	if id := c.GetString(Key); len(id) > 0 {
+		return id
+	}
+	if c.Request != nil {
+		return requestctx.FromContext(c.Request.Context())
+	}
+	return ""
+}
+
+// Generate a random request id in 32 hex characters
+func Generate() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 16)
+	}
+	return hex.EncodeToString(b)
+}
+
+// valid request id is not empty, not too long and has only visible ascii characters,
+// so it is safe to write into logs and headers.
+func valid(id string) bool {
+	if len(id) <= 0 || len(id) > maxLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
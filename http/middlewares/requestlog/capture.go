@@ -0,0 +1,306 @@
+package requestlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	captureKey = "requestlog/capture"
+	redacted   = "***"
+	truncated  = "...[truncated]"
+)
+
+// CaptureOptions of request and response body capture,
+// bodies are logged in json and logfmt formats.
+type CaptureOptions struct {
+	MaxBytes      int      // max bytes captured of each body, default 4096
+	ContentTypes  []string // media types captured, like application/json or text/*, default DefaultCaptureTypes
+	Routes        []string // route templates or paths captured, ends with * to match prefix, empty for all
+	RedactFields  []string // json, form and xml fields and key=value in text redacted, default DefaultRedactFields
+	RedactHeaders []string // headers redacted, default DefaultRedactHeaders
+}
+
+var (
+	// DefaultCaptureTypes are text payloads, multipart and binary payloads are never captured
+	DefaultCaptureTypes = []string{"application/json", "application/x-www-form-urlencoded", "application/xml", "text/*"}
+	// DefaultRedactFields are field names of secrets, they are matched case insensitive
+	DefaultRedactFields = []string{"password", "passwd", "secret", "token", "access_token", "refresh_token", "api_key"}
+	// DefaultRedactHeaders are headers of credentials
+	DefaultRedactHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-Api-Key"}
+)
+
+// captureFields are logged when capture enabled and fields are not configured
+var captureFields = []string{FieldRequestHeaders, FieldRequestBody, FieldResponseBody}
+
+type capturer struct {
+	opts          CaptureOptions
+	routes        []rule
+	redactFields  map[string]bool
+	redactHeaders map[string]bool
+	// patterns of redacted fields, used for bodies can not be parsed,
+	// like truncated json, xml and text
+	jsonRegexp *regexp.Regexp
+	xmlRegexp  *regexp.Regexp
+	kvRegexp   *regexp.Regexp
+}
+
+func newCapturer(opts CaptureOptions) *capturer {
+	if opts.MaxBytes <= 0 {
+		opts.MaxBytes = 4096
+	}
+	if len(opts.ContentTypes) <= 0 {
+		opts.ContentTypes = DefaultCaptureTypes
+	}
+	if len(opts.RedactFields) <= 0 {
+		opts.RedactFields = DefaultRedactFields
+	}
+	if len(opts.RedactHeaders) <= 0 {
+		opts.RedactHeaders = DefaultRedactHeaders
+	}
+
+	cp := &capturer{
+		opts:          opts,
+		redactFields:  map[string]bool{},
+		redactHeaders: map[string]bool{},
+	}
+	for _, r := range opts.Routes {
+		cp.routes = append(cp.routes, newRule(Rule{Pattern: r}))
+	}
+	quoted := make([]string, 0, len(opts.RedactFields))
+	for _, f := range opts.RedactFields {
+		cp.redactFields[strings.ToLower(f)] = true
+		quoted = append(quoted, regexp.QuoteMeta(f))
+	}
+	for _, h := range opts.RedactHeaders {
+		cp.redactHeaders[http.CanonicalHeaderKey(h)] = true
+	}
+	fields := strings.Join(quoted, "|")
+	// "field": value
+	cp.jsonRegexp = regexp.MustCompile(`(?i)("(?:` + fields + `)"\s*:\s*)("(?:[^"\\]|\\.)*"?|[^,}\s]*)`)
+	// <field attr="x">value
+	cp.xmlRegexp = regexp.MustCompile(`(?i)(<(?:[\w.-]+:)?(?:` + fields + `)(?:\s[^>]*)?>)[^<]*`)
+	// field=value, field: value and xml attribute field="value"
+	cp.kvRegexp = regexp.MustCompile(`(?i)((?:^|[^\w])(?:` + fields + `)\s*[=:]\s*)("[^"]*"?|'[^']*'?|[^&\s,;"'<>]*)`)
+	return cp
+}
+
+// capture is the bodies captured of a request
+type capture struct {
+	cp      *capturer
+	reqBody *limitedBuffer
+	reqType string
+	writer  *captureWriter
+}
+
+// start tee request body and wrap response writer if the request should be captured
+func (cp *capturer) start(c *gin.Context) {
+	if len(cp.routes) > 0 {
+		route, path := c.FullPath(), c.Request.URL.Path
+		matched := false
+		for _, r := range cp.routes {
+			if r.match(route) || r.match(path) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return
+		}
+	}
+
+	cpt := &capture{cp: cp}
+	if reqType := c.GetHeader("Content-Type"); c.Request.Body != nil && cp.captured(reqType) {
+		cpt.reqType = reqType
+		cpt.reqBody = &limitedBuffer{limit: cp.opts.MaxBytes}
+		c.Request.Body = &teeBody{ReadCloser: c.Request.Body, buf: cpt.reqBody}
+	}
+	cpt.writer = &captureWriter{ResponseWriter: c.Writer, cp: cp}
+	c.Writer = cpt.writer
+	c.Set(captureKey, cpt)
+}
+
+// captured check media type, multipart and binary payloads are skipped
+func (cp *capturer) captured(contentType string) bool {
+	if len(contentType) <= 0 {
+		return false
+	}
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil || strings.HasPrefix(mt, "multipart/") {
+		return false
+	}
+	for _, t := range cp.opts.ContentTypes {
+		if t == mt || (strings.HasSuffix(t, "/*") && strings.HasPrefix(mt, strings.TrimSuffix(t, "*"))) {
+			return true
+		}
+	}
+	return false
+}
+
+func (cp *capturer) headers(h http.Header) map[string]string {
+	headers := make(map[string]string, len(h))
+	for k, v := range h {
+		if cp.redactHeaders[http.CanonicalHeaderKey(k)] {
+			headers[k] = redacted
+		} else {
+			headers[k] = strings.Join(v, ", ")
+		}
+	}
+	return headers
+}
+
+// body redact fields of json or form body, body can not be parsed is redacted by patterns
+func (cp *capturer) body(buf *limitedBuffer, contentType string) string {
+	if buf == nil || buf.Len() <= 0 {
+		return ""
+	}
+	data := buf.Bytes()
+	mt, _, _ := mime.ParseMediaType(contentType)
+
+	var body string
+	switch {
+	case mt == "application/x-www-form-urlencoded":
+		// scan pairs, so that truncated form is redacted too
+		body = cp.redactForm(string(data))
+	case strings.HasSuffix(mt, "json") && !buf.truncated:
+		var v interface{}
+		if err := json.Unmarshal(data, &v); err == nil {
+			if b, err := json.Marshal(cp.redact(v)); err == nil {
+				body = string(b)
+			}
+		}
+	}
+	if len(body) <= 0 {
+		body = string(data)
+		body = cp.jsonRegexp.ReplaceAllString(body, `${1}"`+redacted+`"`)
+		body = cp.xmlRegexp.ReplaceAllString(body, `${1}`+redacted)
+		body = cp.kvRegexp.ReplaceAllString(body, `${1}`+redacted)
+	}
+	if buf.truncated {
+		body += truncated
+	}
+	return body
+}
+
+// redactForm redact values of key=value pairs, pairs keep their order
+func (cp *capturer) redactForm(form string) string {
+	pairs := strings.Split(form, "&")
+	for i, pair := range pairs {
+		kv := strings.SplitN(pair, "=", 2)
+		key, err := url.QueryUnescape(kv[0])
+		if err != nil {
+			key = kv[0]
+		}
+		if len(kv) == 2 && cp.redactFields[strings.ToLower(key)] {
+			pairs[i] = kv[0] + "=" + redacted
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+func (cp *capturer) redact(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for k, item := range val {
+			if cp.redactFields[strings.ToLower(k)] {
+				val[k] = redacted
+			} else {
+				val[k] = cp.redact(item)
+			}
+		}
+	case []interface{}:
+		for i, item := range val {
+			val[i] = cp.redact(item)
+		}
+	}
+	return v
+}
+
+func captureValue(c *gin.Context, field string) interface{} {
+	v, ok := c.Get(captureKey)
+	if !ok {
+		return ""
+	}
+	cpt := v.(*capture)
+	switch field {
+	case FieldRequestHeaders:
+		return cpt.cp.headers(c.Request.Header)
+	case FieldRequestBody:
+		return cpt.cp.body(cpt.reqBody, cpt.reqType)
+	case FieldResponseBody:
+		return cpt.cp.body(cpt.writer.body, cpt.writer.Header().Get("Content-Type"))
+	}
+	return ""
+}
+
+// limitedBuffer keep the first bytes up to limit
+type limitedBuffer struct {
+	bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if left := b.limit - b.Len(); left < len(p) {
+		b.truncated = true
+		if left > 0 {
+			b.Buffer.Write(p[:left])
+		}
+		return len(p), nil
+	}
+	return b.Buffer.Write(p)
+}
+
+// teeBody copy request body read by handler into buffer
+type teeBody struct {
+	io.ReadCloser
+	buf *limitedBuffer
+}
+
+func (t *teeBody) Read(p []byte) (int, error) {
+	n, err := t.ReadCloser.Read(p)
+	if n > 0 {
+		t.buf.Write(p[:n])
+	}
+	return n, err
+}
+
+// captureWriter copy response body into buffer if its content type is captured
+type captureWriter struct {
+	gin.ResponseWriter
+	cp      *capturer
+	body    *limitedBuffer
+	checked bool
+}
+
+func (w *captureWriter) tee(p []byte) {
+	if !w.checked {
+		w.checked = true
+		if w.cp.captured(w.Header().Get("Content-Type")) {
+			w.body = &limitedBuffer{limit: w.cp.opts.MaxBytes}
+		}
+	}
+	if w.body != nil {
+		w.body.Write(p)
+	}
+}
+
+func (w *captureWriter) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	w.tee(p[:n])
+	return n, err
+}
+
+func (w *captureWriter) WriteString(s string) (int, error) {
+	n, err := w.ResponseWriter.WriteString(s)
+	w.tee([]byte(s[:n]))
+	return n, err
+}
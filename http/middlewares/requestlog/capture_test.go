@@ -0,0 +1,136 @@
+package requestlog
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCaptureBodyRedact(t *testing.T) {
+	cp := newCapturer(CaptureOptions{MaxBytes: 30})
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		want        string
+	}{
+		{
+			name:        "json",
+			contentType: "application/json",
+			body:        `{"user":"bob","password":"x"}`,
+			want:        `{"password":"***","user":"bob"}`,
+		},
+		{
+			name:        "json truncated",
+			contentType: "application/json; charset=utf-8",
+			body:        `{"user":"bob","password":"hunter2hunter2"}`,
+			want:        `{"user":"bob","password":"***"...[truncated]`,
+		},
+		{
+			name:        "form",
+			contentType: "application/x-www-form-urlencoded",
+			body:        `user=bob&Password=hunter2`,
+			want:        `user=bob&Password=***`,
+		},
+		{
+			name:        "form truncated",
+			contentType: "application/x-www-form-urlencoded",
+			body:        `user=bob&password=hunter2hunter2&token=abc`,
+			want:        `user=bob&password=***...[truncated]`,
+		},
+		{
+			name:        "form escaped key",
+			contentType: "application/x-www-form-urlencoded",
+			body:        `api%5Fkey=abc&a=1`,
+			want:        `api%5Fkey=***&a=1`,
+		},
+		{
+			name:        "xml",
+			contentType: "application/xml",
+			body:        `<u><password>x</password></u>`,
+			want:        `<u><password>***</password></u>`,
+		},
+		{
+			name:        "xml attribute truncated",
+			contentType: "application/xml",
+			body:        `<u name="bob" token="abcdefghijkl"/>`,
+			want:        `<u name="bob" token=***...[truncated]`,
+		},
+		{
+			name:        "xml element truncated",
+			contentType: "application/xml",
+			body:        `<user><secret>hunter2hunter2hunter2</secret></user>`,
+			want:        `<user><secret>***...[truncated]`,
+		},
+		{
+			name:        "text",
+			contentType: "text/plain",
+			body:        `login bob password: hunter2`,
+			want:        `login bob password: ***`,
+		},
+		{
+			name:        "text key value",
+			contentType: "text/plain",
+			body:        `user=bob secret=s3cr3t ok`,
+			want:        `user=bob secret=*** ok`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := &limitedBuffer{limit: cp.opts.MaxBytes}
+			buf.Write([]byte(tt.body))
+			if got := cp.body(buf, tt.contentType); got != tt.want {
+				t.Errorf("body = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCaptureDefaultTypes(t *testing.T) {
+	cp := newCapturer(CaptureOptions{})
+
+	for _, ct := range []string{
+		"application/json",
+		"application/x-www-form-urlencoded",
+		"application/xml",
+		"text/plain; charset=utf-8",
+		"text/csv",
+	} {
+		if !cp.captured(ct) {
+			t.Errorf("%s should be captured", ct)
+		}
+	}
+	for _, ct := range []string{"", "multipart/form-data; boundary=x", "application/octet-stream", "image/png"} {
+		if cp.captured(ct) {
+			t.Errorf("%s should not be captured", ct)
+		}
+	}
+}
+
+func TestCaptureHeadersRedact(t *testing.T) {
+	cp := newCapturer(CaptureOptions{})
+
+	headers := cp.headers(map[string][]string{
+		"Authorization": {"Bearer abc"},
+		"Accept":        {"text/html", "application/json"},
+	})
+	if headers["Authorization"] != redacted {
+		t.Errorf("authorization = %s, want redacted", headers["Authorization"])
+	}
+	if !strings.Contains(headers["Accept"], "application/json") {
+		t.Errorf("accept = %s, want joined values", headers["Accept"])
+	}
+}
+
+func TestCaptureFormat(t *testing.T) {
+	capture := &CaptureOptions{}
+	if _, err := WithOptions(Options{Capture: capture}); err == nil {
+		t.Error("capture with text format should fail")
+	}
+	for _, format := range []string{FormatJSON, FormatLogfmt} {
+		if _, err := WithOptions(Options{Format: format, Capture: capture}); err != nil {
+			t.Errorf("capture with %s format got error: %s", format, err.Error())
+		}
+	}
+}
@@ -10,7 +10,9 @@ import (
 	rlogs "github.com/lestrrat-go/file-rotatelogs"
 )
 
-// RequestFileLogMiddleware create rotated log file to record gin request
+// RequestFileLogMiddleware create rotated log file to record gin request,
+// it exits the process if log file can not be created.
+// Deprecated: use New, which returns the error and a closer of log file.
 func RequestFileLogMiddleware(filePath string, rotationHours, maxDays uint) gin.HandlerFunc {
 	var w io.Writer
 
@@ -18,11 +20,7 @@ func RequestFileLogMiddleware(filePath string, rotationHours, maxDays uint) gin.
 		return gin.Logger()
 	}
 
-	w, err := rlogs.New(
-		filePath+".%Y%m%d%H",
-		rlogs.WithRotationTime(time.Duration(rotationHours)*time.Hour),
-		rlogs.WithMaxAge(time.Duration(maxDays)*time.Hour*24),
-	)
+	w, err := NewRotateWriter(filePath, rotationHours, maxDays)
 	if err != nil {
 		log.Fatalf("init gin request log writer got error: %s.\n", err.Error())
 	}
@@ -30,10 +28,61 @@ func RequestFileLogMiddleware(filePath string, rotationHours, maxDays uint) gin.
 	return gin.LoggerWithConfig(gin.LoggerConfig{
 		Formatter: Formatter,
 		Output:    w,
-		SkipPaths: []string{"/ping", "/health", "/healthz"},
+		SkipPaths: DefaultSkipPaths,
 	})
 }
 
+// NewRotateWriter create log file writer rotated by hours, the file has time suffix like .2006010215
+func NewRotateWriter(filePath string, rotationHours, maxDays uint) (io.WriteCloser, error) {
+	return rlogs.New(
+		filePath+".%Y%m%d%H",
+		rlogs.WithRotationTime(time.Duration(rotationHours)*time.Hour),
+		rlogs.WithMaxAge(time.Duration(maxDays)*time.Hour*24),
+	)
+}
+
+// New create access log middleware, writers are created by sinks if outputs not set,
+// the closer closes writers created, call it after server stopped.
+func New(opts Options) (gin.HandlerFunc, io.Closer, error) {
+	var closers multiCloser
+	if opts.Output == nil {
+		w, err := NewSink(opts.Sink)
+		if err != nil {
+			return nil, nil, err
+		}
+		opts.Output = w
+		closers = append(closers, w)
+	}
+	if opts.SlowOutput == nil && opts.SlowSink != nil {
+		w, err := NewSink(*opts.SlowSink)
+		if err != nil {
+			closers.Close()
+			return nil, nil, err
+		}
+		opts.SlowOutput = w
+		closers = append(closers, w)
+	}
+
+	h, err := WithOptions(opts)
+	if err != nil {
+		closers.Close()
+		return nil, nil, err
+	}
+	return h, closers, nil
+}
+
+type multiCloser []io.Closer
+
+func (mc multiCloser) Close() error {
+	var err error
+	for _, c := range mc {
+		if e := c.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
 // Formatter is gin log formatter
 func Formatter(params gin.LogFormatterParams) string {
 	return fmt.Sprintf(
@@ -0,0 +1,111 @@
+package requestlog
+
+import (
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Rule decide whether requests matched are logged,
+// requests failed with status >= 400 or slower than threshold are always logged.
+type Rule struct {
+	// Pattern match route template like /users/:id or request path,
+	// it matches prefix if ends with *, like /static/*
+	Pattern      string
+	Skip         bool    // do not log requests matched
+	SampleRate   float64 // ratio of requests logged in (0, 1], 0 for all
+	SampleBudget int     // max requests logged per second, 0 for no limit
+}
+
+// sampler log requests by rate and per second budget
+type sampler struct {
+	skip   bool
+	rate   float64
+	budget int
+
+	mu     sync.Mutex
+	second int64
+	count  int
+}
+
+func newSampler(skip bool, rate float64, budget int) *sampler {
+	return &sampler{skip: skip, rate: rate, budget: budget}
+}
+
+func (s *sampler) sample() bool {
+	if s.skip {
+		return false
+	}
+	if s.rate > 0 && s.rate < 1 && rand.Float64() >= s.rate {
+		return false
+	}
+	if s.budget <= 0 {
+		return true
+	}
+
+	now := time.Now().Unix()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if now != s.second {
+		s.second, s.count = now, 0
+	}
+	if s.count >= s.budget {
+		return false
+	}
+	s.count++
+	return true
+}
+
+type rule struct {
+	pattern string
+	prefix  bool
+	sampler *sampler
+}
+
+// sampling choose sampler by the first rule matched
+type sampling struct {
+	rules    []rule
+	fallback *sampler
+}
+
+func newSampling(opts Options) *sampling {
+	s := &sampling{fallback: newSampler(false, opts.SampleRate, opts.SampleBudget)}
+	for _, p := range opts.SkipPaths {
+		s.rules = append(s.rules, newRule(Rule{Pattern: p, Skip: true}))
+	}
+	for _, r := range opts.Rules {
+		s.rules = append(s.rules, newRule(r))
+	}
+	return s
+}
+
+func newRule(r Rule) rule {
+	return rule{
+		pattern: strings.TrimSuffix(r.Pattern, "*"),
+		prefix:  strings.HasSuffix(r.Pattern, "*"),
+		sampler: newSampler(r.Skip, r.SampleRate, r.SampleBudget),
+	}
+}
+
+func (s *sampling) sample(c *gin.Context) bool {
+	route, path := c.FullPath(), c.Request.URL.Path
+	for _, r := range s.rules {
+		if r.match(route) || r.match(path) {
+			return r.sampler.sample()
+		}
+	}
+	return s.fallback.sample()
+}
+
+func (r rule) match(v string) bool {
+	if len(v) <= 0 {
+		return false
+	}
+	if r.prefix {
+		return strings.HasPrefix(v, r.pattern)
+	}
+	return v == r.pattern
+}
@@ -0,0 +1,163 @@
+package requestlog
+
+import (
+	"fmt"
+	"io"
+	"log/syslog"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+
+	"github.com/lostyear/go-toolkits/metrics"
+)
+
+// sink types
+const (
+	SinkFile   = "file"   // rotated log file
+	SinkStdout = "stdout" // standard output
+	SinkSyslog = "syslog" // syslog, local socket by default
+)
+
+// SinkOptions create the writer of access log
+type SinkOptions struct {
+	Type string // file, stdout or syslog, default file if path set, or stdout
+
+	Path          string // file path, rotated file has time suffix like .2006010215
+	RotationHours uint   // file rotation hours
+	MaxDays       uint   // file max keep days
+
+	SyslogNetwork string // syslog network like udp or tcp, empty for local socket
+	SyslogAddr    string // syslog address, empty for local socket
+	SyslogTag     string // syslog tag, default program name
+
+	// AsyncBuffer is the max lines buffered to write in background, 0 to write synchronously.
+	// lines are dropped when buffer is full, so slow disk will not block requests.
+	AsyncBuffer int
+}
+
+var droppedLines = metrics.NewCounter(metrics.Opts{
+	Name: "requestlog_dropped_lines_total",
+	Help: "access log lines dropped since async buffer is full",
+})
+
+// NewSink create writer by sink options
+func NewSink(opts SinkOptions) (io.WriteCloser, error) {
+	typ := opts.Type
+	if len(typ) <= 0 {
+		typ = SinkStdout
+		if len(opts.Path) > 0 {
+			typ = SinkFile
+		}
+	}
+
+	var w io.WriteCloser
+	switch typ {
+	case SinkFile:
+		if len(opts.Path) <= 0 {
+			return nil, fmt.Errorf("request log file path is empty")
+		}
+		// rotate writer opens file when writing, so check the dir here
+		if err := os.MkdirAll(filepath.Dir(opts.Path), 0755); err != nil {
+			return nil, fmt.Errorf("create request log dir got error: %s", err.Error())
+		}
+		fw, err := NewRotateWriter(opts.Path, opts.RotationHours, opts.MaxDays)
+		if err != nil {
+			return nil, fmt.Errorf("init request log file got error: %s", err.Error())
+		}
+		w = fw
+	case SinkStdout:
+		w = nopCloser{os.Stdout}
+	case SinkSyslog:
+		sw, err := syslog.Dial(opts.SyslogNetwork, opts.SyslogAddr, syslog.LOG_INFO|syslog.LOG_LOCAL0, opts.SyslogTag)
+		if err != nil {
+			return nil, fmt.Errorf("connect to syslog got error: %s", err.Error())
+		}
+		w = sw
+	default:
+		return nil, fmt.Errorf("request log sink not supported: %s", typ)
+	}
+
+	if opts.AsyncBuffer > 0 {
+		return NewAsyncWriter(w, opts.AsyncBuffer), nil
+	}
+	return w, nil
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
+
+// AsyncWriter write lines in background, lines are dropped when buffer is full
+type AsyncWriter struct {
+	w       io.Writer
+	lines   chan []byte
+	dropped uint64
+
+	mu      sync.RWMutex
+	closed  bool
+	flushed chan struct{}
+}
+
+// NewAsyncWriter create async writer with buffer of lines,
+// the writer is closed by it if it is an io.Closer.
+func NewAsyncWriter(w io.Writer, buffer int) *AsyncWriter {
+	aw := &AsyncWriter{
+		w:       w,
+		lines:   make(chan []byte, buffer),
+		flushed: make(chan struct{}),
+	}
+	go aw.run()
+	return aw
+}
+
+func (aw *AsyncWriter) run() {
+	for line := range aw.lines {
+		aw.w.Write(line)
+	}
+	close(aw.flushed)
+}
+
+// Write copy the line into buffer, it never blocks
+func (aw *AsyncWriter) Write(p []byte) (int, error) {
+	line := make([]byte, len(p))
+	copy(line, p)
+
+	aw.mu.RLock()
+	defer aw.mu.RUnlock()
+	if aw.closed {
+		return 0, fmt.Errorf("async writer closed")
+	}
+	select {
+	case aw.lines <- line:
+	default:
+		atomic.AddUint64(&aw.dropped, 1)
+		droppedLines.Inc()
+	}
+	return len(p), nil
+}
+
+// Dropped return the count of lines dropped
+func (aw *AsyncWriter) Dropped() uint64 {
+	return atomic.LoadUint64(&aw.dropped)
+}
+
+// Close write lines buffered and close the writer
+func (aw *AsyncWriter) Close() error {
+	aw.mu.Lock()
+	if aw.closed {
+		aw.mu.Unlock()
+		return nil
+	}
+	aw.closed = true
+	close(aw.lines)
+	aw.mu.Unlock()
+
+	<-aw.flushed
+	if c, ok := aw.w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
@@ -0,0 +1,325 @@
+package requestlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/lostyear/go-toolkits/http/middlewares/requestid"
+)
+
+// formats of access log
+const (
+	FormatText   = "text"   // tab separated line by Formatter
+	FormatJSON   = "json"   // one json object per line
+	FormatLogfmt = "logfmt" // key=value pairs per line
+)
+
+// field names of structured access log, they are stable for log ingestion
+const (
+	FieldTime         = "time"          // request start time in RFC3339 with nanoseconds
+	FieldHost         = "host"          // request host
+	FieldClientIP     = "client_ip"     // client ip, X-Forwarded-For and X-Real-Ip are used if present
+	FieldMethod       = "method"        // request method
+	FieldPath         = "path"          // request path without query
+	FieldQuery        = "query"         // raw query
+	FieldRoute        = "route"         // matched route template like /users/:id, empty if no route matched
+	FieldProto        = "proto"         // request protocol like HTTP/1.1
+	FieldStatus       = "status"        // response status code
+	FieldLatencyMs    = "latency_ms"    // handling time in milliseconds, in float
+	FieldRequestSize  = "request_size"  // request content length, -1 if unknown
+	FieldResponseSize = "response_size" // response body bytes written
+	FieldReferer      = "referer"       // Referer header
+	FieldUserAgent    = "user_agent"    // User-Agent header
+	FieldError        = "error"         // errors in gin context
+	FieldRequestID    = "request_id"    // id set by requestid middleware, or X-Request-ID of request
+	FieldUserID       = "user_id"       // value of Options.UserIDKey in gin context
+	FieldTraceID      = "trace_id"      // trace id from traceparent or X-B3-TraceId header
+	FieldSpanID       = "span_id"       // span id from traceparent or X-B3-SpanId header
+
+	// fields of body capture, they are logged only when capture enabled
+	FieldRequestHeaders = "request_headers" // request headers with credentials redacted
+	FieldRequestBody    = "request_body"    // request body read by handler, redacted and truncated
+	FieldResponseBody   = "response_body"   // response body, redacted and truncated
+)
+
+// DefaultFields are logged when no fields configured
+var DefaultFields = []string{
+	FieldTime, FieldHost, FieldClientIP, FieldMethod, FieldPath, FieldRoute, FieldProto,
+	FieldStatus, FieldLatencyMs, FieldRequestSize, FieldResponseSize, FieldReferer, FieldUserAgent,
+	FieldError, FieldRequestID, FieldUserID, FieldTraceID, FieldSpanID,
+}
+
+// Options of access log
+type Options struct {
+	Output    io.Writer // log writer, default gin.DefaultWriter, or writer of Sink with New
+	Format    string    // text, json or logfmt, default text
+	Fields    []string  // fields of json and logfmt in order, default DefaultFields
+	UserIDKey string    // gin context key of user id
+	SkipPaths []string  // paths not logged, default /ping, /health, /healthz and /readyz
+
+	// Rules are checked in order after skip paths, the first matched rule decides
+	Rules        []Rule
+	SampleRate   float64 // ratio of requests logged if no rule matched, 0 for all
+	SampleBudget int     // max requests logged per second if no rule matched, 0 for no limit
+
+	// requests with status >= 400 or slower than threshold are always logged
+	SlowThreshold time.Duration // 0 to disable slow request logging
+	SlowOutput    io.Writer     // slow requests are also written to it, nil for none
+
+	// sinks are used by New to create writers if outputs not set
+	Sink     SinkOptions
+	SlowSink *SinkOptions
+
+	// Capture request and response bodies, nil to disable.
+	// bodies are fields of json and logfmt, it is an error with text format.
+	Capture *CaptureOptions
+}
+
+// DefaultSkipPaths are not logged by default
+var DefaultSkipPaths = []string{"/ping", "/health", "/healthz", "/readyz"}
+
+// WithOptions create access log middleware with options, writers are not closed by it
+func WithOptions(opts Options) (gin.HandlerFunc, error) {
+	if opts.Output == nil {
+		opts.Output = gin.DefaultWriter
+	}
+	if len(opts.Format) <= 0 {
+		opts.Format = FormatText
+	}
+	if len(opts.Fields) <= 0 {
+		opts.Fields = DefaultFields
+		if opts.Capture != nil {
+			opts.Fields = append(append([]string{}, DefaultFields...), captureFields...)
+		}
+	}
+	if opts.SkipPaths == nil {
+		opts.SkipPaths = DefaultSkipPaths
+	}
+
+	var format func(c *gin.Context, st time.Time, latency time.Duration) []byte
+	switch opts.Format {
+	case FormatText:
+		if opts.Capture != nil {
+			return nil, fmt.Errorf("request log format %s can not print captured bodies, use %s or %s",
+				FormatText, FormatJSON, FormatLogfmt)
+		}
+		format = textFormat
+	case FormatJSON, FormatLogfmt:
+		for _, f := range opts.Fields {
+			if !knownFields[f] {
+				return nil, fmt.Errorf("request log field not supported: %s", f)
+			}
+		}
+		format = structuredFormat(opts)
+	default:
+		return nil, fmt.Errorf("request log format not supported: %s", opts.Format)
+	}
+
+	sampling := newSampling(opts)
+	var cp *capturer
+	if opts.Capture != nil {
+		cp = newCapturer(*opts.Capture)
+	}
+
+	var mu sync.Mutex
+	out, slowOut := opts.Output, opts.SlowOutput
+	return func(c *gin.Context) {
+		st := time.Now()
+		if cp != nil {
+			cp.start(c)
+		}
+		c.Next()
+		latency := time.Since(st)
+
+		slow := opts.SlowThreshold > 0 && latency >= opts.SlowThreshold
+		if !slow && c.Writer.Status() < 400 && !sampling.sample(c) {
+			return
+		}
+		line := format(c, st, latency)
+
+		mu.Lock()
+		defer mu.Unlock()
+		out.Write(line)
+		if slow && slowOut != nil {
+			slowOut.Write(line)
+		}
+	}, nil
+}
+
+var knownFields = map[string]bool{}
+
+func init() {
+	for _, f := range DefaultFields {
+		knownFields[f] = true
+	}
+	knownFields[FieldQuery] = true
+	for _, f := range captureFields {
+		knownFields[f] = true
+	}
+}
+
+// textFormat keep the line of Formatter
+func textFormat(c *gin.Context, st time.Time, latency time.Duration) []byte {
+	path := c.Request.URL.Path
+	if len(c.Request.URL.RawQuery) > 0 {
+		path += "?" + c.Request.URL.RawQuery
+	}
+	return []byte(Formatter(gin.LogFormatterParams{
+		Request:      c.Request,
+		TimeStamp:    st.Add(latency),
+		StatusCode:   c.Writer.Status(),
+		Latency:      latency,
+		ClientIP:     c.ClientIP(),
+		Method:       c.Request.Method,
+		Path:         path,
+		ErrorMessage: c.Errors.ByType(gin.ErrorTypePrivate).String(),
+		BodySize:     c.Writer.Size(),
+		Keys:         c.Keys,
+	}))
+}
+
+func structuredFormat(opts Options) func(c *gin.Context, st time.Time, latency time.Duration) []byte {
+	return func(c *gin.Context, st time.Time, latency time.Duration) []byte {
+		var buf bytes.Buffer
+		if opts.Format == FormatJSON {
+			buf.WriteByte('{')
+		}
+		for i, f := range opts.Fields {
+			v := fieldValue(c, opts, f, st, latency)
+			if opts.Format == FormatJSON {
+				if i > 0 {
+					buf.WriteByte(',')
+				}
+				k, _ := json.Marshal(f)
+				buf.Write(k)
+				buf.WriteByte(':')
+				b, err := json.Marshal(v)
+				if err != nil {
+					b, _ = json.Marshal(fmt.Sprint(v))
+				}
+				buf.Write(b)
+			} else {
+				if i > 0 {
+					buf.WriteByte(' ')
+				}
+				buf.WriteString(f)
+				buf.WriteByte('=')
+				buf.WriteString(logfmtValue(v))
+			}
+		}
+		if opts.Format == FormatJSON {
+			buf.WriteByte('}')
+		}
+		buf.WriteByte('\n')
+		return buf.Bytes()
+	}
+}
+
+func fieldValue(c *gin.Context, opts Options, field string, st time.Time, latency time.Duration) interface{} {
+	r := c.Request
+	switch field {
+	case FieldTime:
+		return st.Format(time.RFC3339Nano)
+	case FieldHost:
+		return r.Host
+	case FieldClientIP:
+		return c.ClientIP()
+	case FieldMethod:
+		return r.Method
+	case FieldPath:
+		return r.URL.Path
+	case FieldQuery:
+		return r.URL.RawQuery
+	case FieldRoute:
+		return c.FullPath()
+	case FieldProto:
+		return r.Proto
+	case FieldStatus:
+		return c.Writer.Status()
+	case FieldLatencyMs:
+		return float64(latency) / float64(time.Millisecond)
+	case FieldRequestSize:
+		return r.ContentLength
+	case FieldResponseSize:
+		if size := c.Writer.Size(); size > 0 {
+			return size
+		}
+		return 0
+	case FieldReferer:
+		return r.Referer()
+	case FieldUserAgent:
+		return r.UserAgent()
+	case FieldError:
+		return c.Errors.ByType(gin.ErrorTypePrivate).String()
+	case FieldRequestID:
+		if id := requestid.Get(c); len(id) > 0 {
+			return id
+		}
+		return r.Header.Get(requestid.HeaderRequestID)
+	case FieldUserID:
+		if len(opts.UserIDKey) <= 0 {
+			return ""
+		}
+		if v, ok := c.Get(opts.UserIDKey); ok {
+			return fmt.Sprint(v)
+		}
+		return ""
+	case FieldTraceID:
+		traceID, _ := traceIDs(c)
+		return traceID
+	case FieldSpanID:
+		_, spanID := traceIDs(c)
+		return spanID
+	case FieldRequestHeaders, FieldRequestBody, FieldResponseBody:
+		return captureValue(c, field)
+	}
+	return ""
+}
+
+// traceIDs get trace and span id from w3c traceparent or zipkin b3 headers
+func traceIDs(c *gin.Context) (string, string) {
+	// traceparent: version-traceid-spanid-flags
+	if parts := strings.Split(c.GetHeader("traceparent"), "-"); len(parts) == 4 {
+		return parts[1], parts[2]
+	}
+	if traceID := c.GetHeader("X-B3-TraceId"); len(traceID) > 0 {
+		return traceID, c.GetHeader("X-B3-SpanId")
+	}
+	// b3: traceid-spanid-sampled-parentspanid
+	if parts := strings.Split(c.GetHeader("b3"), "-"); len(parts) >= 2 {
+		return parts[0], parts[1]
+	}
+	return "", ""
+}
+
+// logfmtValue quote value if it has space, quote or equal sign
+func logfmtValue(v interface{}) string {
+	var s string
+	switch val := v.(type) {
+	case string:
+		s = val
+	case int:
+		return strconv.Itoa(val)
+	case int64:
+		return strconv.FormatInt(val, 10)
+	case float64:
+		return strconv.FormatFloat(val, 'f', 3, 64)
+	case map[string]string:
+		b, _ := json.Marshal(val)
+		s = string(b)
+	default:
+		s = fmt.Sprint(v)
+	}
+	if len(s) == 0 || strings.ContainsAny(s, " =\"\t\n") {
+		return strconv.Quote(s)
+	}
+	return s
+}
@@ -0,0 +1,119 @@
+package timeout
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/lostyear/go-toolkits/http/response"
+	"github.com/lostyear/go-toolkits/requestctx"
+)
+
+// StatusClientClosedRequest is the status when client canceled the request before timeout
+const StatusClientClosedRequest = 499
+
+// Renderer render the body of timeout or client cancel response
+type Renderer func(r *http.Request, status int) (contentType string, body []byte)
+
+// Options of timeout responses
+type Options struct {
+	Status             int      // status of timeout response, default 504
+	ClientCancelStatus int      // status when client canceled, default 499
+	Render             Renderer // render response body, default response.DefaultResponse in json
+	// OnTimeout is called when request timeout or client canceled, it can be used for logging and metrics
+	OnTimeout func(r *http.Request, status int, elapsed time.Duration)
+}
+
+// Timeout handles timeout of requests with its own options
+type Timeout struct {
+	mu   sync.RWMutex
+	opts Options
+}
+
+// defaultTimeout is used by package functions
+var defaultTimeout = New(Options{})
+
+// New create a timeout with options, zero fields use default values
+func New(opts Options) *Timeout {
+	return &Timeout{opts: withDefaults(opts)}
+}
+
+func withDefaults(opts Options) Options {
+	if opts.Status == 0 {
+		opts.Status = http.StatusGatewayTimeout
+	}
+	if opts.ClientCancelStatus == 0 {
+		opts.ClientCancelStatus = StatusClientClosedRequest
+	}
+	if opts.Render == nil {
+		opts.Render = DefaultRender
+	}
+	return opts
+}
+
+func (t *Timeout) options() Options {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.opts
+}
+
+// DefaultOptions return options used by package functions,
+// which include changes of SetTimeoutStatus and SetTimeoutMessage.
+func DefaultOptions() Options {
+	return defaultTimeout.options()
+}
+
+// Handler handle a func with timeout
+func (t *Timeout) Handler(timeout time.Duration, handler gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		t.serve(c, timeout, handler)
+	}
+}
+
+// Middleware handles timeout exception
+func (t *Timeout) Middleware(timeout time.Duration) gin.HandlerFunc {
+	return t.Handler(timeout, next)
+}
+
+// DefaultRender render response.DefaultResponse in json
+func DefaultRender(r *http.Request, status int) (string, []byte) {
+	msg := "Timeout"
+	if status == StatusClientClosedRequest {
+		msg = "client canceled"
+	}
+	body, _ := json.Marshal(response.DefaultResponse{
+		Status:    status,
+		Message:   msg,
+		RequestID: requestctx.FromContext(r.Context()),
+	})
+	return "application/json; charset=utf-8", body
+}
+
+// SetTimeoutStatus set status of timeout response used by package functions.
+// Deprecated: use New with Options.Status instead.
+func SetTimeoutStatus(status int) {
+	defaultTimeout.mu.Lock()
+	defer defaultTimeout.mu.Unlock()
+	defaultTimeout.opts.Status = status
+}
+
+// SetTimeoutMessage set body of timeout response used by package functions.
+// Deprecated: use New with Options.Render instead.
+func SetTimeoutMessage(msg string) {
+	defaultTimeout.mu.Lock()
+	defer defaultTimeout.mu.Unlock()
+	cancelStatus := defaultTimeout.opts.ClientCancelStatus
+	defaultTimeout.opts.Render = func(r *http.Request, status int) (string, []byte) {
+		if status == cancelStatus {
+			return DefaultRender(r, status)
+		}
+		return "", []byte(msg)
+	}
+}
+
+func next(c *gin.Context) {
+	c.Next()
+}
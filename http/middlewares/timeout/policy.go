@@ -0,0 +1,133 @@
+package timeout
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// headers of client deadline
+const (
+	HeaderRequestTimeout = "X-Request-Timeout" // milliseconds or go duration like 1.5s
+	HeaderGRPCTimeout    = "Grpc-Timeout"      // grpc format like 100m
+)
+
+// RouteTimeout is timeout of requests matched by method and route pattern
+type RouteTimeout struct {
+	Method  string // empty for all methods
+	Path    string // gin route pattern, like /api/v1/users/:id
+	Timeout time.Duration
+	// Stream serves the route without timeout, for streaming responses like
+	// chunked downloads, server-sent events and websocket
+	Stream bool
+}
+
+// Policy decide timeout of each request
+type Policy struct {
+	Default time.Duration  // timeout of routes not in table
+	Routes  []RouteTimeout // timeout table of routes
+	// Max caps the deadline from client header, 0 means client can only shorten the timeout,
+	// client deadline is used as it is for routes without timeout
+	Max time.Duration
+	// IgnoreClientDeadline disables deadline headers from client
+	IgnoreClientDeadline bool
+}
+
+// PolicyMiddleware handles timeout exception with timeout decided by policy
+func PolicyMiddleware(p Policy) gin.HandlerFunc {
+	return defaultTimeout.PolicyMiddleware(p)
+}
+
+// PolicyMiddleware handles timeout exception with timeout decided by policy
+func (t *Timeout) PolicyMiddleware(p Policy) gin.HandlerFunc {
+	routes := make(map[string]RouteTimeout, len(p.Routes))
+	for _, r := range p.Routes {
+		routes[strings.ToUpper(r.Method)+" "+r.Path] = r
+	}
+
+	return func(c *gin.Context) {
+		t.serve(c, p.timeout(c, routes), next)
+	}
+}
+
+// timeout return timeout of request, 0 for no timeout
+func (p Policy) timeout(c *gin.Context, routes map[string]RouteTimeout) time.Duration {
+	timeout := p.Default
+	r, ok := routes[c.Request.Method+" "+c.FullPath()]
+	if !ok {
+		r, ok = routes[" "+c.FullPath()]
+	}
+	if ok {
+		if r.Stream {
+			return 0
+		}
+		timeout = r.Timeout
+	}
+
+	if p.IgnoreClientDeadline {
+		return timeout
+	}
+	client, ok := clientDeadline(c)
+	if !ok {
+		return timeout
+	}
+	max := p.Max
+	if max <= 0 {
+		max = timeout
+	}
+	// no timeout to shorten and no cap, client deadline is used
+	if max <= 0 {
+		return client
+	}
+	if client > max {
+		return max
+	}
+	return client
+}
+
+// clientDeadline parse timeout from request headers
+func clientDeadline(c *gin.Context) (time.Duration, bool) {
+	if v := c.GetHeader(HeaderRequestTimeout); len(v) > 0 {
+		if ms, err := strconv.ParseInt(v, 10, 64); err == nil && ms > 0 {
+			return time.Duration(ms) * time.Millisecond, true
+		}
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			return d, true
+		}
+	}
+	if v := c.GetHeader(HeaderGRPCTimeout); len(v) > 0 {
+		return parseGRPCTimeout(v)
+	}
+	return 0, false
+}
+
+var grpcTimeoutUnits = map[byte]time.Duration{
+	'H': time.Hour,
+	'M': time.Minute,
+	'S': time.Second,
+	'm': time.Millisecond,
+	'u': time.Microsecond,
+	'n': time.Nanosecond,
+}
+
+// parseGRPCTimeout parse grpc-timeout header, it is at most 8 digits with a unit
+func parseGRPCTimeout(v string) (time.Duration, bool) {
+	if len(v) < 2 || len(v) > 9 {
+		return 0, false
+	}
+	unit, ok := grpcTimeoutUnits[v[len(v)-1]]
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(v[:len(v)-1], 10, 64)
+	if err != nil || n <= 0 {
+		return 0, false
+	}
+	if n > int64(math.MaxInt64/unit) {
+		return time.Duration(math.MaxInt64), true
+	}
+	return time.Duration(n) * unit, true
+}
@@ -0,0 +1,146 @@
+package timeout
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestPolicyTimeout(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name   string
+		policy Policy
+		header map[string]string
+		want   time.Duration
+	}{
+		{
+			name:   "default",
+			policy: Policy{Default: time.Second},
+			want:   time.Second,
+		},
+		{
+			name:   "route",
+			policy: Policy{Default: time.Second, Routes: []RouteTimeout{{Method: "get", Path: "/users/:id", Timeout: 3 * time.Second}}},
+			want:   3 * time.Second,
+		},
+		{
+			name:   "route of all methods",
+			policy: Policy{Default: time.Second, Routes: []RouteTimeout{{Path: "/users/:id", Timeout: 2 * time.Second}}},
+			want:   2 * time.Second,
+		},
+		{
+			name:   "stream route",
+			policy: Policy{Default: time.Second, Routes: []RouteTimeout{{Path: "/users/:id", Stream: true}}},
+			header: map[string]string{HeaderRequestTimeout: "100"},
+			want:   0,
+		},
+		{
+			name:   "client shortens",
+			policy: Policy{Default: time.Second},
+			header: map[string]string{HeaderRequestTimeout: "100"},
+			want:   100 * time.Millisecond,
+		},
+		{
+			name:   "client can not extend without max",
+			policy: Policy{Default: time.Second},
+			header: map[string]string{HeaderRequestTimeout: "5s"},
+			want:   time.Second,
+		},
+		{
+			name:   "client extends to max",
+			policy: Policy{Default: time.Second, Max: 3 * time.Second},
+			header: map[string]string{HeaderRequestTimeout: "2s"},
+			want:   2 * time.Second,
+		},
+		{
+			name:   "client capped by max",
+			policy: Policy{Default: time.Second, Max: 3 * time.Second},
+			header: map[string]string{HeaderGRPCTimeout: "1M"},
+			want:   3 * time.Second,
+		},
+		{
+			name:   "client shortens no timeout",
+			policy: Policy{},
+			header: map[string]string{HeaderGRPCTimeout: "250m"},
+			want:   250 * time.Millisecond,
+		},
+		{
+			name:   "client capped by max of no timeout",
+			policy: Policy{Max: time.Second},
+			header: map[string]string{HeaderRequestTimeout: "2s"},
+			want:   time.Second,
+		},
+		{
+			name:   "client ignored",
+			policy: Policy{Default: time.Second, IgnoreClientDeadline: true},
+			header: map[string]string{HeaderRequestTimeout: "100"},
+			want:   time.Second,
+		},
+		{
+			name:   "invalid client deadline",
+			policy: Policy{Default: time.Second},
+			header: map[string]string{HeaderRequestTimeout: "-1"},
+			want:   time.Second,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			routes := make(map[string]RouteTimeout)
+			for _, r := range tt.policy.Routes {
+				routes[strings.ToUpper(r.Method)+" "+r.Path] = r
+			}
+
+			var got time.Duration
+			eng := gin.New()
+			eng.GET("/users/:id", func(c *gin.Context) {
+				got = tt.policy.timeout(c, routes)
+			})
+			req := httptest.NewRequest(http.MethodGet, "/users/1", nil)
+			for k, v := range tt.header {
+				req.Header.Set(k, v)
+			}
+			eng.ServeHTTP(httptest.NewRecorder(), req)
+
+			if got != tt.want {
+				t.Errorf("timeout = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseGRPCTimeout(t *testing.T) {
+	tests := []struct {
+		v    string
+		want time.Duration
+		ok   bool
+	}{
+		{v: "1H", want: time.Hour, ok: true},
+		{v: "2M", want: 2 * time.Minute, ok: true},
+		{v: "3S", want: 3 * time.Second, ok: true},
+		{v: "100m", want: 100 * time.Millisecond, ok: true},
+		{v: "5u", want: 5 * time.Microsecond, ok: true},
+		{v: "7n", want: 7 * time.Nanosecond, ok: true},
+		{v: "99999999H", want: time.Duration(math.MaxInt64), ok: true}, // overflow is capped
+		{v: "S"},
+		{v: "10"},
+		{v: "10x"},
+		{v: "0S"},
+		{v: "-1S"},
+		{v: "123456789S"},
+	}
+
+	for _, tt := range tests {
+		got, ok := parseGRPCTimeout(tt.v)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("parseGRPCTimeout(%q) = %s, %v, want %s, %v", tt.v, got, ok, tt.want, tt.ok)
+		}
+	}
+}
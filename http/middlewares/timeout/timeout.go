@@ -1,126 +1,165 @@
 package timeout
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"fmt"
 	"log"
+	"math"
+	"net"
 	"net/http"
 	"path"
 	"runtime"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
-var (
-	timeoutStatus = http.StatusGatewayTimeout
-	timeoutMsg    = `{"status":504,"message":"Timeout"}`
-
-	clientCancelStatus = 499
-	clientCancelMsg    = "client canceled"
-)
-
-func SetTimeoutStatus(status int) {
-	timeoutStatus = status
-}
-
-func SetTimeoutMessage(msg string) {
-	timeoutMsg = msg
-}
+var abandoned int64
 
 // Handler handle a func with timeout
 func Handler(timeout time.Duration, handler gin.HandlerFunc) gin.HandlerFunc {
-	return timeoutHandlerFunc(timeout, handler)
+	return defaultTimeout.Handler(timeout, handler)
 }
 
 // Middleware handles timeout exception
 func Middleware(timeout time.Duration) gin.HandlerFunc {
-	handler := func(c *gin.Context) {
-		c.Next()
-	}
-	return timeoutHandlerFunc(timeout, handler)
+	return defaultTimeout.Middleware(timeout)
 }
 
-func timeoutHandlerFunc(timeout time.Duration, handler gin.HandlerFunc) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		startTs := time.Now()
-		// if gin framework already run serverError, this is no need
-		if c.Writer.Written() {
+func (t *Timeout) serve(c *gin.Context, timeout time.Duration, handler gin.HandlerFunc) {
+	startTs := time.Now()
+	// if gin framework already run serverError, this is no need
+	if c.Writer.Written() {
+		return
+	}
+	if c.Writer.Status() != 200 {
+		return
+	}
+	// no timeout for this route. request headers are controlled by client,
+	// so streaming routes like websocket and server-sent events are bypassed by RouteTimeout.Stream
+	if timeout <= 0 {
+		handler(c)
+		return
+	}
+
+	ctx := c.Request.Context()
+	timeoutCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	w := c.Writer
+	done := make(chan struct{})
+	// buffered, handler goroutine will not block when timeout already returned
+	panicCh := make(chan interface{}, 1)
+
+	c.Request = c.Request.WithContext(timeoutCtx)
+	tw := &timeoutWriter{
+		ResponseWriter: w,
+		h:              make(http.Header),
+		req:            c.Request,
+	}
+	c.Writer = tw
+
+	go func() {
+		defer func() {
+			if err := recover(); err != nil {
+				panicCh <- err
+				return
+			}
+			close(done)
+		}()
+		handler(c)
+	}()
+
+	select {
+	case p := <-panicCh:
+		// panic again in request goroutine, so that recovery middleware can handle it
+		c.Writer = w
+		panic(p)
+	case <-done:
+		tw.Lock()
+		defer tw.Unlock()
+		// response is already sent to client
+		if tw.streaming || tw.hijacked {
 			return
 		}
-		if c.Writer.Status() != 200 {
+		tw.writeResponseLocked()
+	case <-timeoutCtx.Done():
+		tw.Lock()
+		tw.timedOut = true
+		if tw.streaming || tw.hijacked {
+			// response is committed, handler gets canceled by the context
+			tw.Unlock()
+			waitAbandoned(c, done, panicCh)
 			return
 		}
-
-		ctx := c.Request.Context()
-		timeoutCtx, cancel := context.WithTimeout(ctx, timeout)
-		defer cancel()
-
-		w := c.Writer
-		done := make(chan struct{})
-		panicCh := make(chan interface{})
-
-		c.Request = c.Request.WithContext(timeoutCtx)
-		tw := &timeoutWriter{
-			ResponseWriter: w,
-			h:              make(http.Header),
-			req:            c.Request,
+		opts := t.options()
+		elapsed := time.Since(startTs)
+		tw.code = opts.Status
+		if elapsed < timeout {
+			tw.code = opts.ClientCancelStatus
 		}
-		c.Writer = tw
-
-		go func() {
-			defer func() {
-				if err := recover(); err != nil {
-					panicCh <- err
-				}
-			}()
-			defer close(done)
-			handler(c)
-		}()
-
-		select {
-		case <-done:
-			tw.Lock()
-			defer tw.Unlock()
+		contentType, body := opts.Render(c.Request, tw.code)
+		tw.wbuf.Reset()
+		tw.wbuf.Write(body)
+		// response is complete with content length, the connection is busy
+		// until handler returns, so ask client not to reuse it.
+		if len(contentType) > 0 {
+			w.Header().Set("Content-Type", contentType)
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(tw.wbuf.Len()))
+		w.Header().Set("Connection", "close")
+		w.WriteHeader(tw.code)
+		w.Write(tw.wbuf.Bytes())
+		w.Flush()
+		tw.committed = true
+		tw.Unlock()
+
+		if opts.OnTimeout != nil {
+			opts.OnTimeout(c.Request, tw.code, elapsed)
+		}
+		waitAbandoned(c, done, panicCh)
+	}
+}
 
-			dst := w.Header()
-			for k, vv := range tw.h {
-				dst[k] = vv
-			}
+// waitAbandoned wait for the handler after timeout, it still holds the context
+// and gin will reuse the context after we return. client already got the response.
+func waitAbandoned(c *gin.Context, done chan struct{}, panicCh chan interface{}) {
+	atomic.AddInt64(&abandoned, 1)
+	defer atomic.AddInt64(&abandoned, -1)
+	select {
+	case <-done:
+	case p := <-panicCh:
+		logf(c.Request, "http: panic after timeout: %v", p)
+	}
+}
 
-			if !tw.wroteHeader {
-				if w.Status() > 0 {
-					tw.code = w.Status()
-				} else {
-					tw.code = http.StatusOK
-				}
-			}
-			w.WriteHeader(tw.code)
-			w.Write(tw.wbuf.Bytes())
-		case <-timeoutCtx.Done():
-			latency := time.Since(startTs)
-			if latency < timeout {
-				tw.code = clientCancelStatus
-				tw.wbuf.Reset()
-				tw.wbuf.WriteString(clientCancelMsg)
-			} else {
-				tw.code = timeoutStatus
-				tw.wbuf.Reset()
-				tw.wbuf.WriteString(timeoutMsg)
-			}
-			tw.Lock()
-			defer tw.Unlock()
-			w.WriteHeader(tw.code)
-			w.Write(tw.wbuf.Bytes())
-			tw.timedOut = true
-		}
+// Abandoned return the number of handler goroutines which are still running after timeout
+func Abandoned() int64 {
+	return atomic.LoadInt64(&abandoned)
+}
 
+// Remaining return the time left before request deadline,
+// it returns 0 if deadline exceeded and max duration if request has no deadline.
+// handlers can use it to stop expensive work early.
+func Remaining(c *gin.Context) time.Duration {
+	deadline, ok := c.Request.Context().Deadline()
+	if !ok {
+		return time.Duration(math.MaxInt64)
+	}
+	if left := time.Until(deadline); left > 0 {
+		return left
 	}
+	return 0
 }
 
+// timeoutWriter buffers response until handler done,
+// it turns to write through after Flush, so that streaming responses work.
 type timeoutWriter struct {
 	gin.ResponseWriter
 	req  *http.Request
@@ -131,6 +170,69 @@ type timeoutWriter struct {
 	timedOut    bool
 	wroteHeader bool
 	code        int
+	committed   bool // buffered response written to underlying writer
+	streaming   bool // response committed by Flush, write through
+	hijacked    bool
+}
+
+// writeResponseLocked write header and buffered body to underlying writer
+func (tw *timeoutWriter) writeResponseLocked() {
+	w := tw.ResponseWriter
+	dst := w.Header()
+	for k, vv := range tw.h {
+		dst[k] = vv
+	}
+
+	if !tw.wroteHeader {
+		if w.Status() > 0 {
+			tw.code = w.Status()
+		} else {
+			tw.code = http.StatusOK
+		}
+	}
+	w.WriteHeader(tw.code)
+	w.Write(tw.wbuf.Bytes())
+	tw.wbuf.Reset()
+	tw.committed = true
+}
+
+// expiredLocked check whether the request context is done, handler may see it
+// before timeout is marked, writes after it are dropped like writes after timeout.
+func (tw *timeoutWriter) expiredLocked() bool {
+	return tw.req.Context().Err() != nil
+}
+
+// Flush commit the response and flush it, writes after it go to client directly
+func (tw *timeoutWriter) Flush() {
+	tw.Lock()
+	defer tw.Unlock()
+	if tw.timedOut || tw.hijacked || tw.expiredLocked() {
+		return
+	}
+	if !tw.streaming {
+		tw.writeResponseLocked()
+		tw.streaming = true
+	}
+	tw.ResponseWriter.Flush()
+}
+
+// Hijack let handler take over the connection, like websocket
+func (tw *timeoutWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	tw.Lock()
+	defer tw.Unlock()
+	if tw.timedOut {
+		return nil, nil, http.ErrHandlerTimeout
+	}
+	conn, rw, err := tw.ResponseWriter.Hijack()
+	if err == nil {
+		tw.hijacked = true
+	}
+	return conn, rw, err
+}
+
+// CloseNotify is deprecated by request context, keep it for old handlers
+func (tw *timeoutWriter) CloseNotify() <-chan bool {
+	return tw.ResponseWriter.CloseNotify()
 }
 
 func (tw *timeoutWriter) Header() http.Header {
@@ -151,6 +253,12 @@ func (tw *timeoutWriter) Write(p []byte) (int, error) {
 	if !tw.wroteHeader {
 		tw.writeHeaderLocked(http.StatusOK)
 	}
+	if tw.streaming {
+		if tw.expiredLocked() {
+			return 0, nil
+		}
+		return tw.ResponseWriter.Write(p)
+	}
 	return tw.wbuf.Write(p)
 }
 
@@ -183,6 +291,9 @@ func (tw *timeoutWriter) Status() int {
 func (tw *timeoutWriter) Size() int {
 	tw.RLock()
 	defer tw.RUnlock()
+	if tw.committed || tw.hijacked {
+		return tw.ResponseWriter.Size()
+	}
 	return tw.wbuf.Len()
 }
 
@@ -200,13 +311,22 @@ func (tw *timeoutWriter) WriteHeader(code int) {
 
 func (tw *timeoutWriter) WriteHeaderNow() {
 	if !tw.Wroten() {
-		tw.WriteHeader(tw.code)
+		tw.WriteHeader(tw.Status())
 	}
 }
 
 func (tw *timeoutWriter) WriteString(s string) (n int, err error) {
 	tw.Lock()
 	defer tw.Unlock()
+	if tw.timedOut {
+		return 0, nil
+	}
+	if tw.streaming {
+		if tw.expiredLocked() {
+			return 0, nil
+		}
+		return tw.ResponseWriter.WriteString(s)
+	}
 	return tw.wbuf.WriteString(s)
 
 }
@@ -0,0 +1,236 @@
+package timeout
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/lostyear/go-toolkits/http/middlewares/recovery"
+	"github.com/lostyear/go-toolkits/http/response"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// waitAbandonedCount wait until the number of handlers running after timeout is n
+func waitAbandonedCount(t *testing.T, n int64) {
+	deadline := time.Now().Add(time.Second)
+	for Abandoned() != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("abandoned = %d, want %d", Abandoned(), n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestTimeoutResponse(t *testing.T) {
+	release := make(chan struct{})
+	eng := gin.New()
+	eng.Use(New(Options{}).Middleware(50 * time.Millisecond))
+	eng.GET("/slow", func(c *gin.Context) {
+		<-release
+		c.String(http.StatusOK, "late")
+	})
+	srv := httptest.NewServer(eng)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/slow")
+	if err != nil {
+		t.Fatalf("request got error: %s", err.Error())
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusGatewayTimeout {
+		t.Errorf("status = %d, want %d", resp.StatusCode, http.StatusGatewayTimeout)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "application/json; charset=utf-8" {
+		t.Errorf("content type = %s", ct)
+	}
+	if resp.ContentLength != int64(len(body)) {
+		t.Errorf("content length = %d, body has %d bytes", resp.ContentLength, len(body))
+	}
+	if !resp.Close {
+		t.Error("timeout response should close the connection")
+	}
+	var r response.DefaultResponse
+	if err := json.Unmarshal(body, &r); err != nil {
+		t.Fatalf("unmarshal body %s got error: %s", body, err.Error())
+	}
+	if r.Status != http.StatusGatewayTimeout || r.Message != "Timeout" {
+		t.Errorf("body = %s", body)
+	}
+
+	// handler is still running after client got the response
+	waitAbandonedCount(t, 1)
+	close(release)
+	waitAbandonedCount(t, 0)
+}
+
+func TestClientCancel(t *testing.T) {
+	var status int
+	eng := gin.New()
+	eng.Use(New(Options{
+		OnTimeout: func(r *http.Request, code int, elapsed time.Duration) { status = code },
+	}).Middleware(time.Second))
+	eng.GET("/slow", func(c *gin.Context) {
+		time.Sleep(100 * time.Millisecond)
+		c.String(http.StatusOK, "late")
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	w := httptest.NewRecorder()
+	eng.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/slow", nil).WithContext(ctx))
+
+	if w.Code != StatusClientClosedRequest {
+		t.Errorf("status = %d, want %d", w.Code, StatusClientClosedRequest)
+	}
+	var r response.DefaultResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &r); err != nil || r.Message != "client canceled" {
+		t.Errorf("body = %s", w.Body.String())
+	}
+	if status != StatusClientClosedRequest {
+		t.Errorf("OnTimeout got status %d, want %d", status, StatusClientClosedRequest)
+	}
+	// ServeHTTP returns after the abandoned handler
+	if n := Abandoned(); n != 0 {
+		t.Errorf("abandoned = %d after handler returned, want 0", n)
+	}
+}
+
+func TestTimeoutOptions(t *testing.T) {
+	eng := gin.New()
+	eng.Use(New(Options{
+		Status: http.StatusServiceUnavailable,
+		Render: func(r *http.Request, status int) (string, []byte) {
+			return "text/plain", []byte("busy")
+		},
+	}).Middleware(10 * time.Millisecond))
+	eng.GET("/slow", func(c *gin.Context) {
+		time.Sleep(50 * time.Millisecond)
+	})
+
+	w := httptest.NewRecorder()
+	eng.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/slow", nil))
+	if w.Code != http.StatusServiceUnavailable || w.Body.String() != "busy" {
+		t.Errorf("response = %d %s, want %d busy", w.Code, w.Body.String(), http.StatusServiceUnavailable)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "text/plain" {
+		t.Errorf("content type = %s, want text/plain", ct)
+	}
+}
+
+func TestTimeoutBufferedResponse(t *testing.T) {
+	var size int
+	eng := gin.New()
+	eng.Use(func(c *gin.Context) {
+		c.Next()
+		size = c.Writer.Size()
+	})
+	eng.Use(New(Options{}).Middleware(time.Second))
+	eng.GET("/ok", func(c *gin.Context) {
+		c.Header("X-Handler", "ok")
+		c.String(http.StatusCreated, "hello world")
+	})
+
+	w := httptest.NewRecorder()
+	eng.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ok", nil))
+	if w.Code != http.StatusCreated || w.Body.String() != "hello world" || w.Header().Get("X-Handler") != "ok" {
+		t.Errorf("response = %d %s %v", w.Code, w.Body.String(), w.Header())
+	}
+	if size != len("hello world") {
+		t.Errorf("size = %d, want %d", size, len("hello world"))
+	}
+}
+
+func TestPanicReachRecovery(t *testing.T) {
+	var recovered interface{}
+	eng := gin.New()
+	eng.Use(recovery.WithHook(nil, func(c *gin.Context, err interface{}, brokenPipe bool) {
+		recovered = err
+	}))
+	eng.Use(New(Options{}).Middleware(time.Second))
+	eng.GET("/panic", func(c *gin.Context) {
+		panic("boom")
+	})
+	eng.GET("/error", func(c *gin.Context) {
+		panic(response.NewBadRequestError("bad"))
+	})
+
+	w := httptest.NewRecorder()
+	eng.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/panic", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusInternalServerError)
+	}
+	if recovered != "boom" {
+		t.Errorf("recovered = %v, want boom", recovered)
+	}
+
+	w = httptest.NewRecorder()
+	eng.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/error", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestFlushStreaming(t *testing.T) {
+	next := make(chan struct{})
+	eng := gin.New()
+	eng.Use(New(Options{}).Middleware(time.Second))
+	eng.GET("/stream", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+		c.Writer.WriteString("first\n")
+		c.Writer.Flush()
+		// client reads the first line before handler returns
+		<-next
+		c.Writer.WriteString("second\n")
+	})
+	srv := httptest.NewServer(eng)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/stream")
+	if err != nil {
+		close(next)
+		t.Fatalf("request got error: %s", err.Error())
+	}
+	defer resp.Body.Close()
+
+	r := bufio.NewReader(resp.Body)
+	line, err := r.ReadString('\n')
+	if err != nil || line != "first\n" {
+		close(next)
+		t.Fatalf("first line = %q, %v", line, err)
+	}
+	close(next)
+	line, err = r.ReadString('\n')
+	if err != nil || line != "second\n" {
+		t.Errorf("second line = %q, %v", line, err)
+	}
+}
+
+func TestFlushedResponseNotReplacedByTimeout(t *testing.T) {
+	eng := gin.New()
+	eng.Use(New(Options{}).Middleware(20 * time.Millisecond))
+	eng.GET("/stream", func(c *gin.Context) {
+		c.Writer.WriteString("partial")
+		c.Writer.Flush()
+		<-c.Request.Context().Done()
+		c.Writer.WriteString("dropped")
+	})
+
+	w := httptest.NewRecorder()
+	eng.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/stream", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "partial" {
+		t.Errorf("response = %d %s, want 200 partial", w.Code, w.Body.String())
+	}
+	waitAbandonedCount(t, 0)
+}
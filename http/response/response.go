@@ -1,12 +1,33 @@
 package response
 
-import "net/http"
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/lostyear/go-toolkits/requestctx"
+)
 
 // DefaultResponse is a default return value of http request
 type DefaultResponse struct {
-	Status  int         `json:"status"`  // http status code
-	Message string      `json:"message"` // response message
-	Data    interface{} `json:"data"`    // response data body
+	Status    int         `json:"status"`               // http status code
+	Message   string      `json:"message"`              // response message
+	Data      interface{} `json:"data"`                 // response data body
+	RequestID string      `json:"request_id,omitempty"` // request id set by requestid middleware
+}
+
+// JSON write response in json, request id of the request is filled into response
+func JSON(c *gin.Context, code int, resp *DefaultResponse) {
+	if c.Request != nil {
+		resp.RequestID = requestctx.FromContext(c.Request.Context())
+	}
+	c.JSON(code, resp)
+}
+
+// AbortWithJSON abort the request and write response in json with request id
+func AbortWithJSON(c *gin.Context, code int, resp *DefaultResponse) {
+	c.Abort()
+	JSON(c, code, resp)
 }
 
 // NewOKResonseData create a new response for success response
@@ -0,0 +1,38 @@
+package log
+
+import (
+	"context"
+
+	"github.com/toolkits/pkg/logger"
+
+	"github.com/lostyear/go-toolkits/requestctx"
+)
+
+// DebugfContext log in debug level with request id in context
+func DebugfContext(ctx context.Context, format string, args ...interface{}) {
+	logger.LogDepth(logger.DEBUG, 0, withRequestID(ctx, format), args...)
+}
+
+// InfofContext log in info level with request id in context
+func InfofContext(ctx context.Context, format string, args ...interface{}) {
+	logger.LogDepth(logger.INFO, 0, withRequestID(ctx, format), args...)
+}
+
+// WarningfContext log in warning level with request id in context
+func WarningfContext(ctx context.Context, format string, args ...interface{}) {
+	logger.LogDepth(logger.WARNING, 0, withRequestID(ctx, format), args...)
+}
+
+// ErrorfContext log in error level with request id in context
+func ErrorfContext(ctx context.Context, format string, args ...interface{}) {
+	logger.LogDepth(logger.ERROR, 0, withRequestID(ctx, format), args...)
+}
+
+// withRequestID prefix format with request id, the format is not changed if no id in context
+func withRequestID(ctx context.Context, format string) string {
+	id := requestctx.FromContext(ctx)
+	if len(id) <= 0 {
+		return format
+	}
+	return "[request_id=" + id + "] " + format
+}
@@ -1,9 +1,11 @@
 package log
 
 import (
+	"fmt"
 	"log"
 	"os"
 	"strings"
+	"sync"
 
 	"github.com/toolkits/pkg/logger"
 )
@@ -25,6 +27,19 @@ var StdoutLogger *log.Logger = log.New(os.Stdout, "[LOG OUT]", defaultLogFlags)
 // StderrLogger is default logger print to stdout
 var StderrLogger *log.Logger = log.New(os.Stderr, "[LOG ERR]", defaultLogFlags)
 
+var (
+	levelLock sync.RWMutex
+	level     string
+
+	levels = map[string]bool{
+		"FATAL":   true,
+		"ERROR":   true,
+		"WARNING": true,
+		"INFO":    true,
+		"DEBUG":   true,
+	}
+)
+
 // Init log by config
 func Init(config Config) {
 	backend, err := logger.NewFileBackend(config.Path)
@@ -34,7 +49,31 @@ func Init(config Config) {
 	backend.SetRotateByHour(true)
 	backend.SetKeepHours(config.KeepDays * 24)
 
-	logger.SetLogging(strings.ToUpper(config.Level), backend)
+	levelLock.Lock()
+	defer levelLock.Unlock()
+	level = strings.ToUpper(config.Level)
+	logger.SetLogging(level, backend)
+}
+
+// SetLevel change log level at runtime, level is one of FATAL, ERROR, WARNING, INFO and DEBUG
+func SetLevel(lv string) error {
+	lv = strings.ToUpper(lv)
+	if !levels[lv] {
+		return fmt.Errorf("log level not supported: %s", lv)
+	}
+
+	levelLock.Lock()
+	defer levelLock.Unlock()
+	level = lv
+	logger.SetSeverity(lv)
+	return nil
+}
+
+// Level return current log level
+func Level() string {
+	levelLock.RLock()
+	defer levelLock.RUnlock()
+	return level
 }
 
 // InitDefault changes default log
@@ -0,0 +1,66 @@
+package metrics
+
+import "sync"
+
+// NewCounter return a counter of the default backend,
+// it follows the default backend when it is changed by Init.
+func NewCounter(opts Opts) Counter {
+	return &lazyCounter{lazy: lazy{opts: opts}}
+}
+
+// NewGauge return a gauge of the default backend
+func NewGauge(opts Opts) Gauge {
+	return &lazyGauge{lazy: lazy{opts: opts}}
+}
+
+// NewHistogram return a histogram of the default backend
+func NewHistogram(opts Opts) Histogram {
+	return &lazyHistogram{lazy: lazy{opts: opts}}
+}
+
+// lazy create metric from the default backend when it is used
+type lazy struct {
+	mu      sync.Mutex
+	opts    Opts
+	backend Backend
+	metric  interface{}
+}
+
+func (l *lazy) get(create func(Backend, Opts) interface{}) interface{} {
+	b := Default()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.metric == nil || l.backend != b {
+		l.backend, l.metric = b, create(b, l.opts)
+	}
+	return l.metric
+}
+
+type lazyCounter struct{ lazy }
+
+func (c *lazyCounter) counter() Counter {
+	return c.get(func(b Backend, opts Opts) interface{} { return b.Counter(opts) }).(Counter)
+}
+
+func (c *lazyCounter) Inc(labelValues ...string)            { c.counter().Inc(labelValues...) }
+func (c *lazyCounter) Add(v float64, labelValues ...string) { c.counter().Add(v, labelValues...) }
+
+type lazyGauge struct{ lazy }
+
+func (g *lazyGauge) gauge() Gauge {
+	return g.get(func(b Backend, opts Opts) interface{} { return b.Gauge(opts) }).(Gauge)
+}
+
+func (g *lazyGauge) Set(v float64, labelValues ...string) { g.gauge().Set(v, labelValues...) }
+func (g *lazyGauge) Add(v float64, labelValues ...string) { g.gauge().Add(v, labelValues...) }
+
+type lazyHistogram struct{ lazy }
+
+func (h *lazyHistogram) histogram() Histogram {
+	return h.get(func(b Backend, opts Opts) interface{} { return b.Histogram(opts) }).(Histogram)
+}
+
+func (h *lazyHistogram) Observe(v float64, labelValues ...string) {
+	h.histogram().Observe(v, labelValues...)
+}
@@ -0,0 +1,95 @@
+package metrics
+
+import (
+	"strings"
+	"sync"
+)
+
+// Memory keep metrics in memory, it is used in tests to check reported values
+type Memory struct {
+	mu      sync.RWMutex
+	metrics map[string]*memoryMetric
+}
+
+type memoryMetric struct {
+	mu     sync.Mutex
+	values map[string]float64
+	counts map[string]uint64
+}
+
+// NewMemory create a memory backend
+func NewMemory() *Memory {
+	return &Memory{metrics: map[string]*memoryMetric{}}
+}
+
+// Counter create or get a counter
+func (m *Memory) Counter(opts Opts) Counter {
+	return m.metric(opts.Name)
+}
+
+// Gauge create or get a gauge
+func (m *Memory) Gauge(opts Opts) Gauge {
+	return m.metric(opts.Name)
+}
+
+// Histogram create or get a histogram, its value is the sum of observations
+func (m *Memory) Histogram(opts Opts) Histogram {
+	return m.metric(opts.Name)
+}
+
+// Value return value of counter or gauge, or sum of histogram by label values
+func (m *Memory) Value(name string, labelValues ...string) float64 {
+	mm := m.metric(name)
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+	return mm.values[memoryKey(labelValues)]
+}
+
+// Count return the times of observe of histogram, or add and set of counter and gauge
+func (m *Memory) Count(name string, labelValues ...string) uint64 {
+	mm := m.metric(name)
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+	return mm.counts[memoryKey(labelValues)]
+}
+
+func (m *Memory) metric(name string) *memoryMetric {
+	m.mu.RLock()
+	mm, ok := m.metrics[name]
+	m.mu.RUnlock()
+	if ok {
+		return mm
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if mm, ok = m.metrics[name]; !ok {
+		mm = &memoryMetric{values: map[string]float64{}, counts: map[string]uint64{}}
+		m.metrics[name] = mm
+	}
+	return mm
+}
+
+func memoryKey(labelValues []string) string {
+	return strings.Join(labelValues, "\xff")
+}
+
+func (mm *memoryMetric) Inc(labelValues ...string) { mm.Add(1, labelValues...) }
+
+func (mm *memoryMetric) Add(v float64, labelValues ...string) {
+	key := memoryKey(labelValues)
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+	mm.values[key] += v
+	mm.counts[key]++
+}
+
+func (mm *memoryMetric) Set(v float64, labelValues ...string) {
+	key := memoryKey(labelValues)
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+	mm.values[key] = v
+	mm.counts[key]++
+}
+
+func (mm *memoryMetric) Observe(v float64, labelValues ...string) { mm.Add(v, labelValues...) }
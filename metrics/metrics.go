@@ -0,0 +1,135 @@
+// Package metrics is a small metrics facade, metrics are created from a backend,
+// so that components can report metrics without knowing the monitor system.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"sync"
+)
+
+// backends
+const (
+	BackendPrometheus = "prom"
+	BackendN9e        = "n9e"
+	BackendMemory     = "memory"
+)
+
+// DefaultBuckets of histograms in milliseconds
+var DefaultBuckets = []float64{1, 5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000}
+
+// Counter is a value only increases, label values are in the order of label names
+type Counter interface {
+	Inc(labelValues ...string)
+	Add(v float64, labelValues ...string)
+}
+
+// Gauge is a value can go up and down
+type Gauge interface {
+	Set(v float64, labelValues ...string)
+	Add(v float64, labelValues ...string)
+}
+
+// Histogram observe value distribution, like latency
+type Histogram interface {
+	Observe(v float64, labelValues ...string)
+}
+
+// Opts of a metric
+type Opts struct {
+	Name    string    // metric name, like storage_query_duration_ms
+	Help    string    // description
+	Labels  []string  // label names
+	Buckets []float64 // buckets of histogram, default DefaultBuckets
+}
+
+// Backend create metrics of a monitor system
+type Backend interface {
+	Counter(opts Opts) Counter
+	Gauge(opts Opts) Gauge
+	Histogram(opts Opts) Histogram
+}
+
+// Config of backend
+type Config struct {
+	Backend    string            // prom, n9e or memory, empty to disable
+	Namespace  string            // prefix of metric names
+	StatsdAddr string            // n9e statsd agent address
+	Tags       map[string]string // n9e tags added to all metrics
+}
+
+var (
+	defaultLock    sync.RWMutex
+	defaultBackend Backend = noop{}
+	initBackend    Backend // backend created by Init, it is closed when replaced
+)
+
+// New create backend by config
+func New(cfg Config) (Backend, error) {
+	switch cfg.Backend {
+	case BackendPrometheus:
+		return NewPrometheus(nil, cfg.Namespace), nil
+	case BackendN9e:
+		return NewStatsd(cfg.StatsdAddr, cfg.Namespace, cfg.Tags)
+	case BackendMemory:
+		return NewMemory(), nil
+	case "":
+		return noop{}, nil
+	default:
+		return nil, fmt.Errorf("metrics backend not supported: %s", cfg.Backend)
+	}
+}
+
+// Init create backend by config and set it as default, it is called by the application
+// once, so that storage and timer jobs report to the same monitor system.
+// backend created by last Init is closed, so Init can be called again to switch backend.
+func Init(cfg Config) error {
+	b, err := New(cfg)
+	if err != nil {
+		return err
+	}
+
+	defaultLock.Lock()
+	old := initBackend
+	defaultBackend, initBackend = b, b
+	defaultLock.Unlock()
+
+	if c, ok := old.(io.Closer); ok {
+		if err := c.Close(); err != nil {
+			log.Printf("close metrics backend got error: %s\n", err.Error())
+		}
+	}
+	return nil
+}
+
+// SetDefault set the backend used by package metrics
+func SetDefault(b Backend) {
+	defaultLock.Lock()
+	defer defaultLock.Unlock()
+	defaultBackend = b
+}
+
+// Default return the default backend, metrics are dropped before Init
+func Default() Backend {
+	defaultLock.RLock()
+	defer defaultLock.RUnlock()
+	return defaultBackend
+}
+
+func buckets(opts Opts) []float64 {
+	if len(opts.Buckets) > 0 {
+		return opts.Buckets
+	}
+	return DefaultBuckets
+}
+
+type noop struct{}
+
+func (noop) Counter(Opts) Counter       { return noop{} }
+func (noop) Gauge(Opts) Gauge           { return noop{} }
+func (noop) Histogram(Opts) Histogram   { return noop{} }
+func (noop) Inc(...string)              {}
+func (noop) Add(float64, ...string)     {}
+func (noop) Set(float64, ...string)     {}
+func (noop) Observe(float64, ...string) {}
@@ -0,0 +1,142 @@
+// Package n9e is a client of n9e statsd agent, it sends metrics by udp.
+// it does not read deploy files like statsdlib, all settings are from options.
+package n9e
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+)
+
+// limits of statsd agent
+const (
+	maxTagLen    = 100
+	maxTagCnt    = 8
+	maxMetricLen = 100
+)
+
+// DefaultAddr is the default address of n9e statsd agent
+const DefaultAddr = "127.0.0.1:788"
+
+// Options of statsd client
+type Options struct {
+	Addr      string            // statsd agent udp address, default 127.0.0.1:788
+	Namespace string            // namespace of metrics, it is the prefix before "/" in metric name
+	Tags      map[string]string // tags added to all metrics
+}
+
+// Client send metrics to n9e statsd agent by udp
+type Client struct {
+	conn *net.UDPConn
+	opts Options
+}
+
+// NewClient create a client, address is resolved here
+func NewClient(opts Options) (*Client, error) {
+	if len(opts.Addr) <= 0 {
+		opts.Addr = DefaultAddr
+	}
+	addr, err := net.ResolveUDPAddr("udp", opts.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("resolve statsd address got error: %s", err.Error())
+	}
+	conn, err := net.DialUDP("udp", nil, addr)
+	if err != nil {
+		return nil, fmt.Errorf("open statsd connection got error: %s", err.Error())
+	}
+	return &Client{conn: conn, opts: opts}, nil
+}
+
+// Rpc report a rpc metric, latency and code are aggregated by agent
+func (c *Client) Rpc(metric, caller, callee string, latency time.Duration, code interface{}, tags map[string]string) error {
+	all := map[string]string{"caller": trimTag(caller), "callee": trimTag(callee)}
+	for k, v := range tags {
+		all[k] = v
+	}
+	return c.push(metric, fmt.Sprintf("%v,%v", latency.Nanoseconds()/int64(time.Millisecond), code), "rpc", all)
+}
+
+// Counter report a counter metric
+func (c *Client) Counter(metric string, n int, tags map[string]string) error {
+	return c.push(metric, fmt.Sprintf("%d", n), "c", tags)
+}
+
+// Gauge report a gauge metric
+func (c *Client) Gauge(metric string, value float64, tags map[string]string) error {
+	return c.push(metric, fmt.Sprintf("%f", value), "g", tags)
+}
+
+// Percentile report a value, percentiles like "50", "90" and "99" are calculated by agent
+func (c *Client) Percentile(metric string, value float64, percentiles []string, tags map[string]string) error {
+	if len(percentiles) <= 0 {
+		return fmt.Errorf("percentile not defined")
+	}
+	return c.push(metric, fmt.Sprintf("%f", value), strings.Join(percentiles, ","), tags)
+}
+
+// Close the udp connection
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+func (c *Client) push(metric, value, aggregator string, tags map[string]string) error {
+	all := make(map[string]string, len(c.opts.Tags)+len(tags))
+	for k, v := range c.opts.Tags {
+		all[k] = v
+	}
+	for k, v := range tags {
+		all[k] = v
+	}
+	if err := check(metric, all); err != nil {
+		return err
+	}
+
+	_, err := c.conn.Write([]byte(build(c.opts.Namespace, metric, value, aggregator, all)))
+	return err
+}
+
+// build a packet of lines: value, namespace/metric, tags in k=v and aggregator
+func build(namespace, metric, value, aggregator string, tags map[string]string) string {
+	lines := make([]string, 0, len(tags)+3)
+	lines = append(lines, value, namespace+"/"+metric)
+	for k, v := range tags {
+		lines = append(lines, k+"="+v)
+	}
+	sort.Strings(lines[2:])
+	lines = append(lines, aggregator)
+	return strings.Join(lines, "\n")
+}
+
+func check(metric string, tags map[string]string) error {
+	if len(metric) == 0 {
+		return fmt.Errorf("empty metric")
+	}
+	if len(metric) > maxMetricLen {
+		return fmt.Errorf("metric too long: %s", metric)
+	}
+	if len(tags) > maxTagCnt {
+		return fmt.Errorf("too many tags: %d", len(tags))
+	}
+	for k, v := range tags {
+		if len(k) == 0 || len(v) == 0 {
+			return fmt.Errorf("empty tag: %s=%s", k, v)
+		}
+		if len(k) > maxTagLen || len(v) > maxTagLen {
+			return fmt.Errorf("tag too long: %s=%s", k, v)
+		}
+	}
+	return nil
+}
+
+// trimTag remove query and cut to max tag length
+func trimTag(v string) string {
+	if i := strings.Index(v, "?"); i > 0 {
+		v = v[:i]
+	}
+	if len(v) > maxTagLen {
+		v = v[:maxTagLen]
+	}
+	return v
+}
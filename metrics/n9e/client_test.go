@@ -0,0 +1,109 @@
+package n9e
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// listen a local udp stand-in of statsd agent
+func listen(t *testing.T) *net.UDPConn {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("listen udp got error: %s", err.Error())
+	}
+	return conn
+}
+
+// receive a packet and split it to lines
+func receive(t *testing.T, conn *net.UDPConn) []string {
+	buf := make([]byte, 4096)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatalf("read packet got error: %s", err.Error())
+	}
+	return strings.Split(string(buf[:n]), "\n")
+}
+
+func TestClientPackets(t *testing.T) {
+	agent := listen(t)
+	defer agent.Close()
+
+	cli, err := NewClient(Options{
+		Addr:      agent.LocalAddr().String(),
+		Namespace: "toolkits",
+		Tags:      map[string]string{"service": "api"},
+	})
+	if err != nil {
+		t.Fatalf("create client got error: %s", err.Error())
+	}
+	defer cli.Close()
+
+	tests := []struct {
+		name string
+		send func() error
+		want []string
+	}{
+		{
+			name: "rpc",
+			send: func() error {
+				return cli.Rpc("http.request", "main.handler", "/users/:id?x=1", 25*time.Millisecond, 200,
+					map[string]string{"method": "GET"})
+			},
+			want: []string{"25,200", "toolkits/http.request",
+				"callee=/users/:id", "caller=main.handler", "method=GET", "service=api", "rpc"},
+		},
+		{
+			name: "counter",
+			send: func() error { return cli.Counter("jobs", 3, map[string]string{"job": "sync"}) },
+			want: []string{"3", "toolkits/jobs", "job=sync", "service=api", "c"},
+		},
+		{
+			name: "gauge",
+			send: func() error { return cli.Gauge("queue", 1.5, nil) },
+			want: []string{"1.500000", "toolkits/queue", "service=api", "g"},
+		},
+		{
+			name: "percentile",
+			send: func() error {
+				return cli.Percentile("latency", 12, []string{"50", "99"}, map[string]string{"service": "web"})
+			},
+			want: []string{"12.000000", "toolkits/latency", "service=web", "50,99"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.send(); err != nil {
+				t.Fatalf("send got error: %s", err.Error())
+			}
+			got := receive(t, agent)
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("packet lines = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClientRejectInvalid(t *testing.T) {
+	agent := listen(t)
+	defer agent.Close()
+
+	cli, err := NewClient(Options{Addr: agent.LocalAddr().String()})
+	if err != nil {
+		t.Fatalf("create client got error: %s", err.Error())
+	}
+	defer cli.Close()
+
+	if err := cli.Counter("", 1, nil); err == nil {
+		t.Error("empty metric should be rejected")
+	}
+	if err := cli.Counter("jobs", 1, map[string]string{"job": ""}); err == nil {
+		t.Error("empty tag value should be rejected")
+	}
+	if err := cli.Percentile("latency", 1, nil, nil); err == nil {
+		t.Error("percentile without percentiles should be rejected")
+	}
+}
@@ -0,0 +1,114 @@
+package metrics
+
+import (
+	"log"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Prometheus create metrics registered to a prometheus registerer
+type Prometheus struct {
+	mu         sync.Mutex
+	registerer prometheus.Registerer
+	namespace  string
+	metrics    map[string]interface{}
+}
+
+// NewPrometheus create a prometheus backend, nil registerer for prometheus.DefaultRegisterer
+func NewPrometheus(registerer prometheus.Registerer, namespace string) *Prometheus {
+	if registerer == nil {
+		registerer = prometheus.DefaultRegisterer
+	}
+	return &Prometheus{
+		registerer: registerer,
+		namespace:  namespace,
+		metrics:    map[string]interface{}{},
+	}
+}
+
+// Counter create or get a counter vec
+func (p *Prometheus) Counter(opts Opts) Counter {
+	m := p.register(opts.Name, prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: p.namespace,
+		Name:      opts.Name,
+		Help:      help(opts),
+	}, opts.Labels))
+	if v, ok := m.(*prometheus.CounterVec); ok {
+		return promCounter{v}
+	}
+	return noop{}
+}
+
+// Gauge create or get a gauge vec
+func (p *Prometheus) Gauge(opts Opts) Gauge {
+	m := p.register(opts.Name, prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: p.namespace,
+		Name:      opts.Name,
+		Help:      help(opts),
+	}, opts.Labels))
+	if v, ok := m.(*prometheus.GaugeVec); ok {
+		return promGauge{v}
+	}
+	return noop{}
+}
+
+// Histogram create or get a histogram vec
+func (p *Prometheus) Histogram(opts Opts) Histogram {
+	m := p.register(opts.Name, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: p.namespace,
+		Name:      opts.Name,
+		Help:      help(opts),
+		Buckets:   buckets(opts),
+	}, opts.Labels))
+	if v, ok := m.(*prometheus.HistogramVec); ok {
+		return promHistogram{v}
+	}
+	return noop{}
+}
+
+// register collector, metrics already registered are reused.
+// register error is logged and metric is dropped, since it is a wrong usage.
+func (p *Prometheus) register(name string, c prometheus.Collector) prometheus.Collector {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if m, ok := p.metrics[name]; ok {
+		return m.(prometheus.Collector)
+	}
+
+	if err := p.registerer.Register(c); err != nil {
+		are, ok := err.(prometheus.AlreadyRegisteredError)
+		if !ok {
+			log.Printf("register metric %s got error: %s\n", name, err.Error())
+			return nil
+		}
+		c = are.ExistingCollector
+	}
+	p.metrics[name] = c
+	return c
+}
+
+func help(opts Opts) string {
+	if len(opts.Help) > 0 {
+		return opts.Help
+	}
+	return opts.Name
+}
+
+type promCounter struct{ v *prometheus.CounterVec }
+
+func (c promCounter) Inc(labelValues ...string) { c.v.WithLabelValues(labelValues...).Inc() }
+func (c promCounter) Add(v float64, labelValues ...string) {
+	c.v.WithLabelValues(labelValues...).Add(v)
+}
+
+type promGauge struct{ v *prometheus.GaugeVec }
+
+func (g promGauge) Set(v float64, labelValues ...string) { g.v.WithLabelValues(labelValues...).Set(v) }
+func (g promGauge) Add(v float64, labelValues ...string) { g.v.WithLabelValues(labelValues...).Add(v) }
+
+type promHistogram struct{ v *prometheus.HistogramVec }
+
+func (h promHistogram) Observe(v float64, labelValues ...string) {
+	h.v.WithLabelValues(labelValues...).Observe(v)
+}
@@ -0,0 +1,102 @@
+package metrics
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/lostyear/go-toolkits/metrics/n9e"
+)
+
+// DefaultPercentiles reported by statsd histograms
+var DefaultPercentiles = []string{"50", "90", "99"}
+
+// Statsd send metrics to n9e statsd agent, values are aggregated by the agent
+type Statsd struct {
+	cli *n9e.Client
+}
+
+// NewStatsd create a statsd backend, empty address for n9e.DefaultAddr
+func NewStatsd(addr, namespace string, tags map[string]string) (*Statsd, error) {
+	cli, err := n9e.NewClient(n9e.Options{
+		Addr:      addr,
+		Namespace: namespace,
+		Tags:      tags,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Statsd{cli: cli}, nil
+}
+
+// Counter create a counter reported as statsd counter
+func (s *Statsd) Counter(opts Opts) Counter {
+	return statsdCounter{cli: s.cli, opts: opts}
+}
+
+// Gauge create a gauge, values are kept locally to support Add
+func (s *Statsd) Gauge(opts Opts) Gauge {
+	return &statsdGauge{cli: s.cli, opts: opts, values: map[string]float64{}}
+}
+
+// Histogram create a histogram reported as statsd percentiles, buckets are not used
+func (s *Statsd) Histogram(opts Opts) Histogram {
+	return statsdHistogram{cli: s.cli, opts: opts}
+}
+
+// Close the statsd connection
+func (s *Statsd) Close() error {
+	return s.cli.Close()
+}
+
+// tags pair label names and values, empty values are skipped since agent rejects them
+func tags(names, values []string) map[string]string {
+	t := make(map[string]string, len(names))
+	for i, name := range names {
+		if i < len(values) && len(values[i]) > 0 {
+			t[name] = values[i]
+		}
+	}
+	return t
+}
+
+type statsdCounter struct {
+	cli  *n9e.Client
+	opts Opts
+}
+
+func (c statsdCounter) Inc(labelValues ...string) { c.Add(1, labelValues...) }
+func (c statsdCounter) Add(v float64, labelValues ...string) {
+	c.cli.Counter(c.opts.Name, int(v), tags(c.opts.Labels, labelValues))
+}
+
+type statsdGauge struct {
+	cli    *n9e.Client
+	opts   Opts
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+func (g *statsdGauge) Set(v float64, labelValues ...string) {
+	g.mu.Lock()
+	g.values[strings.Join(labelValues, "\xff")] = v
+	g.mu.Unlock()
+	g.cli.Gauge(g.opts.Name, v, tags(g.opts.Labels, labelValues))
+}
+
+func (g *statsdGauge) Add(v float64, labelValues ...string) {
+	key := strings.Join(labelValues, "\xff")
+	g.mu.Lock()
+	g.values[key] += v
+	v = g.values[key]
+	g.mu.Unlock()
+	g.cli.Gauge(g.opts.Name, v, tags(g.opts.Labels, labelValues))
+}
+
+type statsdHistogram struct {
+	cli  *n9e.Client
+	opts Opts
+}
+
+func (h statsdHistogram) Observe(v float64, labelValues ...string) {
+	h.cli.Percentile(h.opts.Name, v, DefaultPercentiles, tags(h.opts.Labels, labelValues))
+}
@@ -0,0 +1,21 @@
+// Package requestctx carries request id in context, it has no dependency,
+// so that logs and clients of other services can read the id set by http middleware.
+package requestctx
+
+import "context"
+
+type requestIDKey struct{}
+
+// NewContext return a context with request id, it can be passed to clients of other services
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// FromContext return request id in context, empty if not set
+func FromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
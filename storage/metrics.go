@@ -0,0 +1,70 @@
+package storage
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/lostyear/go-toolkits/metrics"
+)
+
+const startTimeKey = "metrics:start_time"
+
+var queryDuration = metrics.NewHistogram(metrics.Opts{
+	Name:   "storage_query_duration_ms",
+	Help:   "db query duration in milliseconds",
+	Labels: []string{"operation", "table", "status"},
+})
+
+// registerMetrics time all db operations by gorm callbacks
+func registerMetrics(db *gorm.DB) error {
+	cb := db.Callback()
+	processors := []struct {
+		operation string
+		before    func(name string, fn func(*gorm.DB)) error
+		after     func(name string, fn func(*gorm.DB)) error
+	}{
+		{"create", cb.Create().Before("gorm:create").Register, cb.Create().After("gorm:create").Register},
+		{"query", cb.Query().Before("gorm:query").Register, cb.Query().After("gorm:query").Register},
+		{"update", cb.Update().Before("gorm:update").Register, cb.Update().After("gorm:update").Register},
+		{"delete", cb.Delete().Before("gorm:delete").Register, cb.Delete().After("gorm:delete").Register},
+		{"row", cb.Row().Before("gorm:row").Register, cb.Row().After("gorm:row").Register},
+		{"raw", cb.Raw().Before("gorm:raw").Register, cb.Raw().After("gorm:raw").Register},
+	}
+	for _, p := range processors {
+		if err := p.before("metrics:before_"+p.operation, beforeQuery); err != nil {
+			return err
+		}
+		if err := p.after("metrics:after_"+p.operation, afterQuery(p.operation)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func beforeQuery(db *gorm.DB) {
+	db.InstanceSet(startTimeKey, time.Now())
+}
+
+func afterQuery(operation string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		v, ok := db.InstanceGet(startTimeKey)
+		if !ok {
+			return
+		}
+		st, ok := v.(time.Time)
+		if !ok {
+			return
+		}
+
+		status := "ok"
+		if db.Error != nil && db.Error != gorm.ErrRecordNotFound {
+			status = "error"
+		}
+		table := "unknown"
+		if db.Statement != nil && len(db.Statement.Table) > 0 {
+			table = db.Statement.Table
+		}
+		queryDuration.Observe(float64(time.Since(st))/float64(time.Millisecond), operation, table, status)
+	}
+}
@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"context"
 	"log"
 	"strings"
 	"time"
@@ -94,6 +95,11 @@ func InitDatabase(config Config) *gorm.DB {
 		log.Fatalf("open db connection failed! Error: %s\n", err)
 	}
 
+	// 统计数据库操作耗时
+	if err := registerMetrics(db); err != nil {
+		log.Printf("register db metrics failed! Error: %s\n", err)
+	}
+
 	// 设置读写分离
 	if len(config.ReaderDSN) > 0 {
 		db.Use(dbresolver.Register(
@@ -130,3 +136,14 @@ func Close(db *gorm.DB) {
 		log.Printf("Close database error: %s\n", err.Error())
 	}
 }
+
+// HealthCheck return a check func which ping the db, it can be used by http health
+func HealthCheck(db *gorm.DB) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		sqldb, err := db.DB()
+		if err != nil {
+			return err
+		}
+		return sqldb.PingContext(ctx)
+	}
+}
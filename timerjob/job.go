@@ -1,12 +1,14 @@
 package timerjob
 
 import (
+	"context"
 	"log"
 	"math/rand"
 	"sync"
 	"time"
 
 	"github.com/go-redis/redis"
+	"github.com/lostyear/go-toolkits/metrics"
 	"github.com/lostyear/go-toolkits/recovery"
 )
 
@@ -25,13 +27,22 @@ type RedisLockerJob struct {
 	LockExpire time.Duration
 }
 
+var runDuration = metrics.NewHistogram(metrics.Opts{
+	Name:   "timerjob_run_duration_ms",
+	Help:   "timer job run duration in milliseconds",
+	Labels: []string{"job", "status"},
+})
+
 const (
 	unlockScript = "if redis.call('get', KEYS[1]) == ARGV[1] then return redis.call('del', KEYS[1]) else return 0 end"
 )
 
 // Run Start the job running
 func (j *RedisLockerJob) Run() {
-	j.Worker()
+	if len(j.Name) <= 0 {
+		j.Name = j.LockID
+	}
+	j.work()
 	j.stopCh = make(chan struct{})
 	j.ticker = time.NewTicker(j.Interval)
 
@@ -46,7 +57,7 @@ func (j *RedisLockerJob) Run() {
 				num := rand.Int()
 				j.lock(num)
 				defer j.unlock(num)
-				j.Worker()
+				j.work()
 			}()
 		case <-j.stopCh:
 			wg.Wait()
@@ -71,8 +82,14 @@ func (j *RedisLockerJob) Stop() {
 	j.BaseTimerJob.Stop()
 }
 
+// HealthCheck ping the redis used for lock, it can be used by http health
+func (j *RedisLockerJob) HealthCheck(ctx context.Context) error {
+	return j.Redis.WithContext(ctx).Ping().Err()
+}
+
 // BaseTimerJob is a simple job
 type BaseTimerJob struct {
+	Name     string // job name in metrics, default is "default", or lock id of RedisLockerJob
 	Interval time.Duration
 	Worker   func()
 	stopCh   chan struct{}
@@ -81,7 +98,7 @@ type BaseTimerJob struct {
 
 // Run Start the job running
 func (j *BaseTimerJob) Run() {
-	j.Worker()
+	j.work()
 	j.stopCh = make(chan struct{})
 	j.ticker = time.NewTicker(j.Interval)
 
@@ -93,7 +110,7 @@ func (j *BaseTimerJob) Run() {
 			go func() {
 				defer recovery.Recovery()
 				defer wg.Done()
-				j.Worker()
+				j.work()
 			}()
 		case <-j.stopCh:
 			wg.Wait()
@@ -107,3 +124,20 @@ func (j *BaseTimerJob) Stop() {
 	j.ticker.Stop()
 	close(j.stopCh)
 }
+
+// work run worker once and record its duration,
+// the panic goes on to the recovery of caller after recorded.
+func (j *BaseTimerJob) work() {
+	name := j.Name
+	if len(name) <= 0 {
+		name = "default"
+	}
+	st := time.Now()
+	status := "panic"
+	defer func() {
+		runDuration.Observe(float64(time.Since(st))/float64(time.Millisecond), name, status)
+	}()
+
+	j.Worker()
+	status = "ok"
+}